@@ -6,31 +6,44 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"sort"
 
 	korra "github.com/cwinters/korra/lib"
 )
 
+type dumpOpts struct {
+	dumper  string
+	filters string
+	groupBy string
+	inputs  string
+	output  string
+}
+
 func dumpCmd() command {
 	fs := flag.NewFlagSet("korra dump", flag.ExitOnError)
-	dumper := fs.String("dumper", "", "Dumper [json, csv]")
-	inputs := fs.String("inputs", "", "Input files as glob")
-	output := fs.String("output", "stdout", "Output file")
-	//	include := fs.String("include", "", "(TBD) Filter expression(s) to include only certain transactions")
-	//	exclude := fs.String("exclude", "", "(TBD) Filter expression(s) to exclude transactions")
+	opts := &dumpOpts{}
+	fs.StringVar(&opts.dumper, "dumper", "", "Dumper [json, csv]")
+	fs.StringVar(&opts.filters, "filters", "", "One or more space-separated filters to dump only some of the inputs")
+	fs.StringVar(&opts.groupBy, "group-by", "", "Dump results together by group [session, line, step, iteration, branch]")
+	fs.StringVar(&opts.inputs, "inputs", "", "Input files as glob")
+	fs.StringVar(&opts.output, "output", "stdout", "Output file")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
-		return dump(*dumper, *inputs, *output)
+		return dump(opts)
 	}}
 }
 
-func dump(dumper, inputs, output string) error {
-	dump, ok := dumpers[dumper]
+func dump(opts *dumpOpts) error {
+	dump, ok := dumpers[opts.dumper]
 	if !ok {
-		return fmt.Errorf("unsupported dumper: %s", dumper)
+		return fmt.Errorf("unsupported dumper: %s", opts.dumper)
+	}
+	if err := checkGrouping(opts.groupBy); err != nil {
+		return err
 	}
 
-	files := korra.GlobResults(inputs)
+	files := korra.GlobResults(opts.inputs)
 	srcs := make([]io.Reader, len(files))
 	for i, f := range files {
 		in, err := korra.File(f, false)
@@ -41,41 +54,77 @@ func dump(dumper, inputs, output string) error {
 		srcs[i] = in
 	}
 
-	out, err := korra.File(output, true)
+	out, err := korra.File(opts.output, true)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	if dumpHeaders[dumper] != nil {
-		out.Write(dumpHeaders[dumper].Header())
+	if dumpHeaders[opts.dumper] != nil {
+		out.Write(dumpHeaders[opts.dumper].Header())
 	}
 
+	// filters and groups need every result up front, otherwise each is
+	// dumped as it's read
+	buffered := opts.filters != "" || opts.groupBy != ""
+	var results korra.Results
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
 	res, errs := korra.Collect(srcs...)
 
+outer:
 	for {
 		select {
 		case _ = <-sig:
 			return nil
 		case r, ok := <-res:
 			if !ok {
-				return nil
+				break outer
 			}
-			dmp, err := dump.Dump(r)
-			if err != nil {
-				return err
-			} else if _, err = out.Write(dmp); err != nil {
+			if buffered {
+				results = append(results, r)
+				continue
+			}
+			if err = dumpResult(out, dump, r); err != nil {
 				return err
 			}
 		case err, ok := <-errs:
 			if !ok {
-				return nil
+				break outer
 			}
 			return err
 		}
 	}
+
+	if !buffered {
+		return nil
+	}
+	sort.Sort(results)
+	results = filterResults(results, opts.filters)
+	if opts.groupBy != "" {
+		names, groups := groupResults(results, opts.groupBy)
+		var grouped korra.Results
+		for _, name := range names {
+			grouped = append(grouped, groups[name]...)
+		}
+		results = grouped
+	}
+	for _, r := range results {
+		if err = dumpResult(out, dump, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpResult(out io.Writer, dump korra.Dumper, r *korra.Result) error {
+	dmp, err := dump.Dump(r)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(dmp)
+	return err
 }
 
 var dumpers = map[string]korra.Dumper{
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// filterResults keeps the results matching every one of the filters, given
+// as space-separated 'Name=value' specs:
+//
+//    Latency=100-500   latency in ms, either end may be left off
+//    Method=POST
+//    Path=/cart        path contains this
+//    Session=api-*     session name matches this glob
+//    Line=12           action on this line of the script, or login.txt:3
+//    Step=checkout     action after this STEP in the script
+//    Iteration=2       run in this iteration of the script
+//    Polled            a second or later attempt of a POLL
+//    Time=+1m          from a minute after the first result, or up to it with -1m
+func filterResults(results korra.Results, filters string) korra.Results {
+	trimmed := strings.TrimSpace(filters)
+	if trimmed == "" {
+		return results
+	}
+	filterGroup := newFilterGroup(trimmed, results)
+	var filtered korra.Results
+	for _, result := range results {
+		if filterGroup.Matches(result) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+type ResultFilterGroup struct {
+	filters []func(*korra.Result) bool
+}
+
+func newFilterGroup(filterSpecs string, results korra.Results) ResultFilterGroup {
+	group := ResultFilterGroup{}
+	for _, filterSpec := range strings.Split(filterSpecs, " ") {
+		pieces := strings.Split(filterSpec, "=")
+		switch pieces[0] {
+		case "Latency":
+			latencyPieces := strings.Split(pieces[1], "-")
+			min, max := 0, -1 // no maximum
+			var err error
+			if len(latencyPieces) != 2 {
+				err = fmt.Errorf("expected min-max")
+			} else if latencyPieces[0] == "" {
+				max, err = strconv.Atoi(latencyPieces[1])
+			} else if latencyPieces[1] == "" {
+				min, err = strconv.Atoi(latencyPieces[0])
+			} else {
+				min, err = strconv.Atoi(latencyPieces[0])
+				if err == nil {
+					max, err = strconv.Atoi(latencyPieces[1])
+				}
+			}
+			if err != nil {
+				panic(fmt.Errorf("Bad 'Latency' filter specification [%s]: %s", pieces[1], err))
+			}
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				resultMillis := int(result.Latency / time.Millisecond)
+				return resultMillis >= min && (max < 0 || resultMillis <= max)
+			})
+		case "Method":
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return result.Method == pieces[1]
+			})
+		case "Path":
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return strings.Contains(result.Path, pieces[1])
+			})
+		case "Session":
+			if _, err := filepath.Match(pieces[1], ""); err != nil {
+				panic(fmt.Errorf("Bad 'Session' filter specification [%s]: %s", pieces[1], err))
+			}
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				ok, _ := filepath.Match(pieces[1], result.Session)
+				return ok
+			})
+		case "Line":
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return result.Line == pieces[1]
+			})
+		case "Step":
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return result.Step == pieces[1]
+			})
+		case "Iteration":
+			iteration, err := strconv.Atoi(pieces[1])
+			if err != nil {
+				panic(fmt.Errorf("Bad 'Iteration' filter specification [%s]: %s", pieces[1], err))
+			}
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return result.Iteration == iteration
+			})
+		case "Polled":
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				return result.RequestCount > 1
+			})
+		// Examples:
+		//    Time=1m  => Include results from start to 1 minute after start
+		//    Time=-1m  => (same as above)
+		//    Time=+1m => Include results from 1 minute after start to end
+		case "Time":
+			timeSpecText := pieces[1]
+			lookback := true
+			direction := timeSpecText[0:1]
+			if direction == "-" || direction == "+" {
+				lookback = direction == "-"
+				timeSpecText = timeSpecText[1:]
+			}
+			duration, err := time.ParseDuration(timeSpecText)
+			if err != nil {
+				panic(fmt.Errorf("Bad 'Time' filter specification [%s]: %s", pieces[1], err))
+			}
+			anchorTime := results[0].Timestamp.Add(duration)
+			group.filters = append(group.filters, func(result *korra.Result) bool {
+				if lookback {
+					return result.Timestamp.Before(anchorTime)
+				}
+				return result.Timestamp.After(anchorTime)
+			})
+		}
+	}
+	return group
+}
+
+func (g *ResultFilterGroup) Matches(result *korra.Result) bool {
+	for _, filter := range g.filters {
+		if !filter(result) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupings say how to group results, each returning the name of the group
+// a result belongs to
+var groupings = map[string]func(*korra.Result) string{
+	"branch":    func(result *korra.Result) string { return result.Branch },
+	"iteration": resultIteration,
+	"line":      func(result *korra.Result) string { return result.Session + " line " + result.Line },
+	"session":   func(result *korra.Result) string { return result.Session },
+	"step":      func(result *korra.Result) string { return result.Step },
+}
+
+// resultIteration is blank for results from versions that didn't record it
+func resultIteration(result *korra.Result) string {
+	if result.Iteration == 0 {
+		return ""
+	}
+	return strconv.Itoa(result.Iteration)
+}
+
+// checkGrouping returns an error if results can't be grouped the given way
+func checkGrouping(by string) error {
+	if _, ok := groupings[by]; by != "" && !ok {
+		return fmt.Errorf("Unknown grouping '%s', expected one of branch, iteration, line, session or step", by)
+	}
+	return nil
+}
+
+// groupResults splits the results into groups, returning the names of the
+// groups in the order they first appear. Results without a value to group
+// by -- those from older versions, or actions outside any STEP -- go in the
+// group '(none)'.
+func groupResults(results korra.Results, by string) ([]string, map[string]korra.Results) {
+	groupOf := groupings[by]
+	var names []string
+	groups := make(map[string]korra.Results)
+	for _, result := range results {
+		name := groupOf(result)
+		if name == "" || (by == "line" && result.Line == "") {
+			name = "(none)"
+		}
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], result)
+	}
+	return names, groups
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+type inspectOpts struct {
+	inputs  string
+	line    string
+	list    bool
+	output  string
+	session string
+	status  string
+}
+
+func inspectCmd() command {
+	fs := flag.NewFlagSet("korra inspect", flag.ExitOnError)
+	opts := &inspectOpts{}
+	fs.StringVar(&opts.inputs, "inputs", ".", "Capture files (comma separated, glob, or dir with .capture files; cwd*)")
+	fs.StringVar(&opts.line, "line", "", "Only captures from this script line, e.g. 12 or login.txt:3")
+	fs.BoolVar(&opts.list, "list", false, "List captures a line each rather than showing them in full")
+	fs.StringVar(&opts.output, "output", "stdout", "Output file")
+	fs.StringVar(&opts.session, "session", "", "Only captures from sessions with names matching this glob")
+	fs.StringVar(&opts.status, "status", "", "Only captures with this status code, or class of them like 5xx (0 for no response)")
+
+	return command{fs, func(args []string) error {
+		fs.Parse(args)
+		return inspect(opts)
+	}}
+}
+
+func inspect(opts *inspectOpts) error {
+	if opts.session != "" {
+		if _, err := filepath.Match(opts.session, ""); err != nil {
+			return fmt.Errorf("Bad -session glob '%s': %s", opts.session, err)
+		}
+	}
+	if strings.Trim(opts.status, "0123456789x") != "" {
+		return fmt.Errorf("Expected -status as a code (500) or class (5xx), got '%s'", opts.status)
+	}
+	out, err := korra.File(opts.output, true)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	for _, file := range korra.GlobCaptures(opts.inputs) {
+		in, err := korra.File(file, false)
+		if err != nil {
+			return err
+		}
+		err = korra.ReadCaptures(in, func(capture *korra.Capture) error {
+			if !opts.matches(capture) {
+				return nil
+			}
+			if opts.list {
+				fmt.Fprintln(w, capture)
+			} else {
+				writeCapture(w, capture)
+			}
+			return nil
+		})
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %s", file, err)
+		}
+	}
+	return nil
+}
+
+func (opts *inspectOpts) matches(capture *korra.Capture) bool {
+	if opts.session != "" {
+		if ok, _ := filepath.Match(opts.session, capture.Session); !ok {
+			return false
+		}
+	}
+	if opts.line != "" && capture.Line != opts.line {
+		return false
+	}
+	return opts.status == "" || statusPattern(opts.status, capture.Code)
+}
+
+// statusPattern returns true if the code matches the pattern, where an 'x'
+// matches any digit
+func statusPattern(pattern string, code uint16) bool {
+	digits := strconv.Itoa(int(code))
+	if pattern == digits {
+		return true
+	} else if len(pattern) != len(digits) {
+		return false
+	}
+	for idx := range pattern {
+		if pattern[idx] != 'x' && pattern[idx] != digits[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeCapture shows the request and response much as they went over the
+// wire, marked with '>' and '<' like curl does
+func writeCapture(w io.Writer, capture *korra.Capture) {
+	fmt.Fprintf(w, "=== %s\n", capture)
+	fmt.Fprintf(w, "> %s %s\n", capture.Method, capture.URL)
+	writeHeaders(w, "> ", capture.RequestHeader)
+	writeBody(w, "> ", capture.RequestBody)
+	if capture.Code != 0 {
+		fmt.Fprintf(w, "< %s\n", capture.Status)
+		writeHeaders(w, "< ", capture.ResponseHeader)
+		writeBody(w, "< ", capture.ResponseBody)
+	}
+	if capture.Truncated {
+		fmt.Fprintln(w, "(bodies cut short)")
+	}
+	if capture.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", capture.Error)
+	}
+	fmt.Fprintln(w)
+}
+
+func writeHeaders(w io.Writer, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+func writeBody(w io.Writer, prefix string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	fmt.Fprintln(w, prefix)
+	for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
@@ -0,0 +1,110 @@
+package korra
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AbortCondition is a sign that the target has fallen over and a run
+// should stop early, checked against live stats of every session's
+// results. It's one of:
+//
+//    error-rate>5%/1m   more than 5% of results in the last minute failed
+//    p95>2s/1m          the 95th percentile latency over the last minute
+//                       was above 2 seconds (any percentile works)
+//    conn-errors>=50    50 results in a row got no response at all
+//
+// Conditions over a window don't apply until it has at least
+// MinAbortSamples results, so a single early failure doesn't stop a run.
+type AbortCondition struct {
+	Raw        string
+	Metric     string // error-rate, conn-errors or pNN
+	Window     time.Duration
+	inclusive  bool
+	rate       float64
+	count      int
+	latency    time.Duration
+	percentile float64
+}
+
+const MinAbortSamples = 10
+
+var abortCondition = regexp.MustCompile(`^(error-rate|conn-errors|p\d+(?:\.\d+)?)\s*(>=|>)\s*([^/\s]+)\s*(?:/\s*(\S+))?$`)
+
+func NewAbortCondition(spec string) (*AbortCondition, error) {
+	matches := abortCondition.FindStringSubmatch(strings.TrimSpace(spec))
+	if matches == nil {
+		return nil, fmt.Errorf("Expected abort condition like error-rate>5%%/1m, p95>2s/1m or conn-errors>=50, got '%s'", spec)
+	}
+	condition := &AbortCondition{Raw: spec, Metric: matches[1], inclusive: matches[2] == ">="}
+	threshold, window := matches[3], matches[4]
+	if condition.Metric == "conn-errors" {
+		if window != "" {
+			return nil, fmt.Errorf("Expected no window for conn-errors, got '%s'", spec)
+		}
+		count, err := strconv.Atoi(threshold)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("Expected a count of at least 1 for conn-errors, got '%s'", threshold)
+		}
+		condition.count = count
+		return condition, nil
+	}
+
+	if window == "" {
+		return nil, fmt.Errorf("Expected a window for %s (e.g. %s/1m), got '%s'", condition.Metric, condition.Metric, spec)
+	}
+	var err error
+	if condition.Window, err = time.ParseDuration(window); err != nil || condition.Window < time.Second {
+		return nil, fmt.Errorf("Expected a window of at least 1s, got '%s'", window)
+	}
+	if condition.Metric == "error-rate" {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		if err != nil || !strings.HasSuffix(threshold, "%") {
+			return nil, fmt.Errorf("Expected a percentage for error-rate, got '%s'", threshold)
+		}
+		condition.rate = percent / 100
+		return condition, nil
+	}
+	condition.percentile, _ = strconv.ParseFloat(condition.Metric[1:], 64)
+	if condition.percentile <= 0 || condition.percentile > 100 {
+		return nil, fmt.Errorf("Expected a percentile from 1 to 100, got '%s'", condition.Metric)
+	}
+	if condition.latency, err = time.ParseDuration(threshold); err != nil {
+		return nil, fmt.Errorf("Expected a duration for %s, got '%s'", condition.Metric, threshold)
+	}
+	return condition, nil
+}
+
+// Check returns a description of why the run should stop if the condition
+// holds for the stats, or an empty string if not
+func (c *AbortCondition) Check(stats *LiveStats) string {
+	if c.Metric == "conn-errors" {
+		if count := stats.ConsecutiveConnErrors(); c.exceeds(float64(count), float64(c.count)) {
+			return fmt.Sprintf("%d connection errors in a row (%s)", count, c)
+		}
+		return ""
+	}
+	window := stats.Window(c.Window)
+	if window.Requests < MinAbortSamples {
+		return ""
+	}
+	if c.Metric == "error-rate" {
+		if rate := window.ErrorRate(); c.exceeds(rate, c.rate) {
+			return fmt.Sprintf("error rate %.2f%% over the last %s (%s)", rate*100, c.Window, c)
+		}
+	} else if latency := window.Percentile(c.percentile); c.exceeds(float64(latency), float64(c.latency)) {
+		return fmt.Sprintf("%s latency %s over the last %s (%s)", c.Metric, latency, c.Window, c)
+	}
+	return ""
+}
+
+func (c *AbortCondition) exceeds(value, threshold float64) bool {
+	return value > threshold || (c.inclusive && value == threshold)
+}
+
+func (c *AbortCondition) String() string {
+	return c.Raw
+}
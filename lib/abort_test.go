@@ -0,0 +1,57 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAbortConditions(t *testing.T) {
+	stats := NewLiveStats(time.Minute)
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		result := &Result{Timestamp: now, Code: 200, Latency: time.Duration(i+1) * 100 * time.Millisecond}
+		if i%4 == 0 {
+			result.Code, result.Error = 500, "500 Internal Server Error"
+		}
+		stats.Observe("user_1.txt", result)
+	}
+	for _, spec := range []string{"error-rate>20%/1m", "p95>1.5s/1m", "p50>=1s/10s"} {
+		condition, err := NewAbortCondition(spec)
+		if err != nil {
+			t.Fatalf("%s: %s", spec, err)
+		}
+		if reason := condition.Check(stats); reason == "" {
+			t.Errorf("%s: expected to hold", spec)
+		}
+	}
+	for _, spec := range []string{"error-rate>25%/1m", "p95>2s/1m", "conn-errors>=3"} {
+		condition, err := NewAbortCondition(spec)
+		if err != nil {
+			t.Fatalf("%s: %s", spec, err)
+		}
+		if reason := condition.Check(stats); reason != "" {
+			t.Errorf("%s: expected not to hold, got %s", spec, reason)
+		}
+	}
+
+	connErrors, _ := NewAbortCondition("conn-errors>=3")
+	for i := 0; i < 3; i++ {
+		stats.Observe("user_2.txt", &Result{Timestamp: now, Error: "connection refused"})
+	}
+	if reason := connErrors.Check(stats); !strings.HasPrefix(reason, "3 connection errors in a row") {
+		t.Errorf("want 3 connection errors, got %q", reason)
+	}
+	stats.Observe("user_2.txt", &Result{Timestamp: now, Code: 200})
+	if reason := connErrors.Check(stats); reason != "" {
+		t.Errorf("want a response to reset connection errors, got %q", reason)
+	}
+}
+
+func TestAbortConditionErrors(t *testing.T) {
+	for _, spec := range []string{"errors>5%/1m", "error-rate>5/1m", "error-rate>5%", "p95>2s", "p95>slow/1m", "p0>2s/1m", "conn-errors>0", "conn-errors>5/1m", "error-rate>5%/1ms"} {
+		if _, err := NewAbortCondition(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package korra
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Arrivals is the rate at which new sessions start in an open model, where
+// the number of sessions running depends on how quickly they finish rather
+// than being fixed. With Poisson arrivals the gaps between sessions are
+// drawn at random (exponentially distributed) around the rate, like users
+// showing up independently; otherwise they're constant.
+type Arrivals struct {
+	PerSecond float64
+	Poisson   bool
+}
+
+// NewArrivals parses a rate like '5', '5/s', '300/m' or '1000/h' -- a bare
+// number is per second -- for the given kind of arrivals, 'constant' or
+// 'poisson'.
+func NewArrivals(rate, kind string) (*Arrivals, error) {
+	arrivals := &Arrivals{}
+	switch kind {
+	case "constant":
+	case "poisson":
+		arrivals.Poisson = true
+	default:
+		return nil, fmt.Errorf("Expected constant or poisson arrivals, got '%s'", kind)
+	}
+	tokens := strings.SplitN(rate, "/", 2)
+	count, err := strconv.ParseFloat(strings.TrimSpace(tokens[0]), 64)
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("Expected a positive arrival rate like 5/s or 300/m, got '%s'", rate)
+	}
+	per := "s"
+	if len(tokens) == 2 {
+		per = strings.TrimSpace(tokens[1])
+	}
+	switch per {
+	case "s":
+		arrivals.PerSecond = count
+	case "m":
+		arrivals.PerSecond = count / 60
+	case "h":
+		arrivals.PerSecond = count / 3600
+	default:
+		return nil, fmt.Errorf("Expected arrival rate per s, m or h, got '%s'", rate)
+	}
+	return arrivals, nil
+}
+
+// Gap returns how long to wait before the next session arrives, drawn from
+// r for Poisson arrivals
+func (a *Arrivals) Gap(r *rand.Rand) time.Duration {
+	mean := float64(time.Second) / a.PerSecond
+	if a.Poisson {
+		return time.Duration(r.ExpFloat64() * mean)
+	}
+	return time.Duration(mean)
+}
+
+func (a *Arrivals) String() string {
+	kind := "constant"
+	if a.Poisson {
+		kind = "poisson"
+	}
+	return fmt.Sprintf("%s arrivals, %.2f/s", kind, a.PerSecond)
+}
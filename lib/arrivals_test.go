@@ -0,0 +1,41 @@
+package korra
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestArrivals(t *testing.T) {
+	for rate, perSecond := range map[string]float64{"5": 5, "5/s": 5, "300/m": 5, "18000/h": 5} {
+		arrivals, err := NewArrivals(rate, "constant")
+		if err != nil {
+			t.Fatalf("%s: %s", rate, err)
+		}
+		if arrivals.PerSecond != perSecond || arrivals.Gap(nil) != 200*time.Millisecond {
+			t.Errorf("%s: want 5/s, got %s", rate, arrivals)
+		}
+	}
+
+	arrivals, err := NewArrivals("10/s", "poisson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	var total time.Duration
+	for i := 0; i < 10000; i++ {
+		total += arrivals.Gap(r)
+	}
+	if mean := total / 10000; mean < 95*time.Millisecond || mean > 105*time.Millisecond {
+		t.Errorf("want mean gap near 100ms, got %s", mean)
+	}
+
+	for _, rate := range []string{"0", "fast", "5/d"} {
+		if _, err := NewArrivals(rate, "constant"); err == nil {
+			t.Errorf("%s: expected error", rate)
+		}
+	}
+	if _, err := NewArrivals("5/s", "bursty"); err == nil {
+		t.Error("expected error for unknown kind of arrivals")
+	}
+}
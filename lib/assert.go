@@ -0,0 +1,157 @@
+package korra
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Assertion is a check on a response that marks the transaction as failed
+// if it doesn't hold, even if the status code indicates success. It's
+// declared in a script underneath an HTTP command as one of:
+//
+//    ASSERT status 200,201
+//    ASSERT header Content-Type == application/json
+//    ASSERT header Content-Type ~ ^application/json
+//    ASSERT body contains "status":"ok"
+//    ASSERT body ~ "id":\s*\d+
+//    ASSERT json $.status == ok
+//    ASSERT json $.data.id ~ ^\d+$
+//    ASSERT latency < 500
+//
+// where '~' matches a regular expression and latency is in milliseconds.
+type Assertion struct {
+	Raw        string
+	subject    string
+	arg        string
+	op         string
+	value      string
+	codes      map[int]bool
+	pattern    *regexp.Regexp
+	maxLatency time.Duration
+}
+
+func NewAssertion(spec string) (*Assertion, error) {
+	assertion := &Assertion{Raw: spec}
+	tokens := strings.SplitN(spec, " ", 2)
+	assertion.subject = tokens[0]
+	switch assertion.subject {
+	case "status":
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("Expected status codes, got '%s'", spec)
+		}
+		assertion.codes = make(map[int]bool)
+		for _, code := range strings.Split(tokens[1], ",") {
+			num, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				return nil, fmt.Errorf("Expected comma-separated status codes, got '%s'", tokens[1])
+			}
+			assertion.codes[num] = true
+		}
+		return assertion, nil
+	case "header", "json":
+		if tokens = strings.SplitN(spec, " ", 4); len(tokens) != 4 {
+			return nil, fmt.Errorf("Expected %s NAME OPERATOR VALUE, got '%s'", assertion.subject, spec)
+		}
+		assertion.arg, assertion.op, assertion.value = tokens[1], tokens[2], tokens[3]
+		if assertion.subject == "json" {
+			if _, err := parseJSONPath(assertion.arg); err != nil {
+				return nil, err
+			}
+		}
+		return assertion, assertion.compileOp("==", "~")
+	case "body":
+		if tokens = strings.SplitN(spec, " ", 3); len(tokens) != 3 {
+			return nil, fmt.Errorf("Expected body OPERATOR VALUE, got '%s'", spec)
+		}
+		assertion.op, assertion.value = tokens[1], tokens[2]
+		return assertion, assertion.compileOp("contains", "~")
+	case "latency":
+		if tokens = strings.SplitN(spec, " ", 3); len(tokens) != 3 || tokens[1] != "<" {
+			return nil, fmt.Errorf("Expected latency < MILLIS, got '%s'", spec)
+		}
+		millis, err := strconv.Atoi(tokens[2])
+		if err != nil {
+			return nil, fmt.Errorf("Expected int milliseconds for latency, got '%s'", tokens[2])
+		}
+		assertion.maxLatency = time.Duration(millis) * time.Millisecond
+		return assertion, nil
+	}
+	return nil, fmt.Errorf("Unknown assertion '%s'; expected status, header, body, json or latency", assertion.subject)
+}
+
+func (a *Assertion) compileOp(ops ...string) error {
+	for _, op := range ops {
+		if a.op != op {
+			continue
+		}
+		if op == "~" {
+			var err error
+			if a.pattern, err = regexp.Compile(a.value); err != nil {
+				return fmt.Errorf("Bad regex '%s': %s", a.value, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Expected operator %s for %s assertion, got '%s'", strings.Join(ops, " or "), a.subject, a.op)
+}
+
+// IsStatus returns true if this assertion replaces the usual check for a
+// successful status code
+func (a *Assertion) IsStatus() bool {
+	return a.subject == "status"
+}
+
+// NeedsBody returns true if the assertion inspects the response body
+func (a *Assertion) NeedsBody() bool {
+	return a.subject == "body" || a.subject == "json"
+}
+
+// Check returns an error describing how the response (with its already-read
+// body) fails this assertion, or nil if it holds.
+func (a *Assertion) Check(response *http.Response, body []byte, latency time.Duration) error {
+	switch a.subject {
+	case "status":
+		if !a.codes[response.StatusCode] {
+			return fmt.Errorf("got status %d", response.StatusCode)
+		}
+	case "header":
+		return a.compare(response.Header.Get(a.arg))
+	case "json":
+		value, err := jsonPathValue(body, a.arg)
+		if err != nil {
+			return err
+		}
+		return a.compare(value)
+	case "body":
+		if a.pattern != nil {
+			if !a.pattern.Match(body) {
+				return fmt.Errorf("no match in body")
+			}
+		} else if !bytes.Contains(body, []byte(a.value)) {
+			return fmt.Errorf("not found in body")
+		}
+	case "latency":
+		if latency >= a.maxLatency {
+			return fmt.Errorf("took %d ms", int64(latency/time.Millisecond))
+		}
+	}
+	return nil
+}
+
+func (a *Assertion) compare(value string) error {
+	if a.pattern != nil && !a.pattern.MatchString(value) {
+		return fmt.Errorf("got '%s'", value)
+	} else if a.pattern == nil && value != a.value {
+		return fmt.Errorf("got '%s'", value)
+	}
+	return nil
+}
+
+func (a *Assertion) String() string {
+	return a.Raw
+}
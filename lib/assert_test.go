@@ -0,0 +1,44 @@
+package korra
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAssertions(t *testing.T) {
+	response := &http.Response{StatusCode: 200, Header: http.Header{}}
+	response.Header.Set("Content-Type", "application/json; charset=utf-8")
+	body := []byte(`{"status": "error", "id": 12}`)
+
+	for spec, holds := range map[string]bool{
+		"status 200,201": true,
+		"status 201":     false,
+		"header Content-Type ~ ^application/json": true,
+		"header Content-Type == text/html":        false,
+		`body contains "id": 12`:                  true,
+		"body ~ \"status\":\\s*\"ok\"":            false,
+		"json $.status == ok":                     false,
+		"json $.id ~ ^\\d+$":                      true,
+		"latency < 500":                           true,
+		"latency < 5":                             false,
+	} {
+		assertion, err := NewAssertion(spec)
+		if err != nil {
+			t.Fatalf("%s: %s", spec, err)
+		}
+		if err = assertion.Check(response, body, 10*time.Millisecond); holds && err != nil {
+			t.Errorf("%s: expected to hold, got: %s", spec, err)
+		} else if !holds && err == nil {
+			t.Errorf("%s: expected to fail", spec)
+		}
+	}
+}
+
+func TestAssertionErrors(t *testing.T) {
+	for _, spec := range []string{"status", "status ok", "header Content-Type", "body = foo", "latency > 5", "json id == 5", "cookie foo"} {
+		if _, err := NewAssertion(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
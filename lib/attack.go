@@ -1,19 +1,28 @@
 package korra
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
 	"strings"
 	"time"
 )
 
 // Attacker is an attack executor which wraps an http.Client
 type Attacker struct {
-	dialer    *net.Dialer
-	client    http.Client
-	redirects int
+	dialer      *net.Dialer
+	captureBody int  // bytes of bodies to capture
+	capturing   bool // whether to capture requests and responses at all
+	client      http.Client
+	jar         http.CookieJar
+	limiter     *RateLimiter
+	maxBody     int64
+	redirects   int
+	timeout     time.Duration // for the whole request, body and all
 }
 
 var (
@@ -35,7 +44,7 @@ var (
 // NewAttacker returns a new Attacker with default options which are overridden
 // by the optionally provided opts.
 func NewAttacker(opts ...func(*Attacker)) *Attacker {
-	a := &Attacker{}
+	a := &Attacker{timeout: DefaultTimeout}
 	a.dialer = &net.Dialer{
 		LocalAddr: &net.TCPAddr{IP: DefaultLocalAddr.IP, Zone: DefaultLocalAddr.Zone},
 		KeepAlive: 30 * time.Second,
@@ -43,8 +52,10 @@ func NewAttacker(opts ...func(*Attacker)) *Attacker {
 	}
 	a.client = http.Client{
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			Dial:  a.dialer.Dial,
+			Proxy:                 http.ProxyFromEnvironment,
+			DisableCompression:    true, // see acceptGzip
+			DialContext:           a.dialer.DialContext,
+			IdleConnTimeout:       90 * time.Second,
 			ResponseHeaderTimeout: DefaultTimeout,
 			TLSClientConfig:       DefaultTLSConfig,
 			TLSHandshakeTimeout:   10 * time.Second,
@@ -56,6 +67,67 @@ func NewAttacker(opts ...func(*Attacker)) *Attacker {
 	return a
 }
 
+// Cookies returns a functional option which toggles whether the Attacker
+// keeps its own cookie jar, sending cookies set by earlier responses with
+// later requests like a browser does.
+func Cookies(enabled bool) func(*Attacker) {
+	return func(a *Attacker) {
+		if enabled {
+			a.EnableCookies()
+		} else {
+			a.DisableCookies()
+		}
+	}
+}
+
+// SeedCookies returns a functional option which enables the Attacker's
+// cookie jar and fills it with the given cookies.
+func SeedCookies(seeds []*CookieSeed) func(*Attacker) {
+	return func(a *Attacker) {
+		a.EnableCookies()
+		for _, seed := range seeds {
+			a.jar.SetCookies(seed.URL, []*http.Cookie{seed.Cookie})
+		}
+	}
+}
+
+// EnableCookies starts sending and storing cookies, creating the cookie jar
+// if needed; cookies stored before a call to DisableCookies are kept.
+func (a *Attacker) EnableCookies() {
+	if a.jar == nil {
+		a.jar, _ = cookiejar.New(nil) // only errors with bad options
+	}
+	a.client.Jar = a.jar
+}
+
+// DisableCookies stops sending and storing cookies
+func (a *Attacker) DisableCookies() {
+	a.client.Jar = nil
+}
+
+// ClearCookies throws away every stored cookie
+func (a *Attacker) ClearCookies() {
+	a.jar, _ = cookiejar.New(nil)
+	if a.client.Jar != nil {
+		a.client.Jar = a.jar
+	}
+}
+
+// CloseIdleConnections closes the connections kept open for later requests,
+// which the Attacker still opens again if needed
+func (a *Attacker) CloseIdleConnections() {
+	a.client.Transport.(*http.Transport).CloseIdleConnections()
+}
+
+// RateLimit returns a functional option which makes the Attacker wait for
+// the limiter before every request; give the same limiter to every Attacker
+// to cap their combined rate.
+func RateLimit(limiter *RateLimiter) func(*Attacker) {
+	return func(a *Attacker) {
+		a.limiter = limiter
+	}
+}
+
 // KeepAlive returns a functional option which toggles KeepAlive
 // connections on the dialer and transport.
 func KeepAlive(keepalive bool) func(*Attacker) {
@@ -64,7 +136,7 @@ func KeepAlive(keepalive bool) func(*Attacker) {
 		tr.DisableKeepAlives = !keepalive
 		if !keepalive {
 			a.dialer.KeepAlive = 0
-			tr.Dial = a.dialer.Dial
+			tr.DialContext = a.dialer.DialContext
 		}
 	}
 }
@@ -75,7 +147,7 @@ func LocalAddr(addr net.IPAddr) func(*Attacker) {
 	return func(a *Attacker) {
 		tr := a.client.Transport.(*http.Transport)
 		a.dialer.LocalAddr = &net.TCPAddr{IP: addr.IP, Zone: addr.Zone}
-		tr.Dial = a.dialer.Dial
+		tr.DialContext = a.dialer.DialContext
 	}
 }
 
@@ -94,13 +166,15 @@ func Redirects(n int) func(*Attacker) {
 }
 
 // Timeout returns a functional option which sets the maximum amount of time
-// an Attacker will wait for a request to be responded to.
+// an Attacker will wait for a request to be responded to, including reading
+// the whole response body.
 func Timeout(d time.Duration) func(*Attacker) {
 	return func(a *Attacker) {
+		a.timeout = d
 		tr := a.client.Transport.(*http.Transport)
 		tr.ResponseHeaderTimeout = d
 		a.dialer.Timeout = d
-		tr.Dial = a.dialer.Dial
+		tr.DialContext = a.dialer.DialContext
 	}
 }
 
@@ -115,21 +189,31 @@ func TLSConfig(c *tls.Config) func(*Attacker) {
 
 // Hit reads the next target from the targeter and sends the HTTP request with
 // the headers and body from the Target, recording the bytes sent and received,
-// the status code and error message.
-func (a *Attacker) Hit(targeter Targeter, tm time.Time, requestCount int) *Result {
+// the status code and error message. Values named by the target's extractors
+// are pulled from the response and stored in vars. Cancelling ctx cancels
+// the request.
+func (a *Attacker) Hit(ctx context.Context, targeter Targeter, tm time.Time, requestCount int, vars *Variables) *Result {
 	var (
+		body     []byte
 		err      error
 		request  *http.Request
 		response *http.Response
 		result   = Result{Timestamp: tm, RequestCount: requestCount}
 		tgt      *Target
+		trace    = &phaseTrace{}
+		capture  *Capture
 	)
 
 	defer func() {
 		result.Latency = time.Since(tm)
+		trace.record(&result)
 		if err != nil {
 			result.Error = err.Error()
 		}
+		if capture != nil {
+			capture.Timestamp, capture.Latency, capture.Error = result.Timestamp, result.Latency, result.Error
+			result.capture = capture
+		}
 	}()
 
 	if tgt, err = targeter(); err != nil {
@@ -142,26 +226,92 @@ func (a *Attacker) Hit(targeter Targeter, tm time.Time, requestCount int) *Resul
 		return &result
 	}
 
+	// time spent waiting on the rate limit isn't part of the latency
+	if a.limiter != nil {
+		if result.Throttle, err = a.limiter.Wait(ctx, request.URL.Host); err != nil {
+			return &result
+		}
+		tm = time.Now()
+		result.Timestamp = tm
+	}
+	requestCtx := ctx
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		requestCtx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	request = request.WithContext(httptrace.WithClientTrace(requestCtx, trace.clientTrace()))
+	gzipped := acceptGzip(request)
+	capture = a.startCapture(request)
+
 	if response, err = a.client.Do(request); err != nil {
 		// ignore redirect errors when the user set --redirects=NoFollow
 		if a.redirects == NoFollow && strings.Contains(err.Error(), "stopped after") {
 			err = nil
 		}
+		err = a.timedOut(ctx, requestCtx, err)
 		return &result
 	}
-	response.Body.Close()
-
 	if request.ContentLength != -1 {
 		result.BytesOut = uint64(request.ContentLength)
 	}
+	result.Code = uint16(response.StatusCode)
 
-	if response.ContentLength != -1 {
-		result.BytesIn = uint64(response.ContentLength)
+	body, err = a.readBody(response, gzipped, needsBody(tgt), capture, &result)
+	response.Body.Close()
+	trace.readBody()
+	if err != nil {
+		err = a.timedOut(ctx, requestCtx, err)
+		return &result
 	}
 
-	if result.Code = uint16(response.StatusCode); result.HasErrorCode() {
+	if result.HasErrorCode() && !tgt.HasStatusAssertion() {
 		result.Error = response.Status
 	}
 
+	for _, assertion := range tgt.Assertions {
+		if assertErr := assertion.Check(response, body, time.Since(tm)); assertErr != nil {
+			result.Assertion = assertion.Raw
+			if result.Error == "" {
+				result.Error = fmt.Sprintf("Assertion failed [%s]: %s", assertion, assertErr)
+			}
+			break
+		}
+	}
+
+	for _, extractor := range tgt.Extractors {
+		value, extractErr := extractor.Extract(response, body)
+		if extractErr != nil {
+			if result.Error == "" {
+				result.Error = fmt.Sprintf("Extract %s: %s", extractor.Name, extractErr)
+			}
+			continue
+		}
+		vars.Set(extractor.Name, value)
+	}
+
 	return &result
 }
+
+// timedOut replaces the error with a plainer one if it's because the request
+// ran out of time, rather than being cancelled
+func (a *Attacker) timedOut(ctx, requestCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && requestCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timed out after %s", a.timeout)
+	}
+	return err
+}
+
+func needsBody(tgt *Target) bool {
+	for _, extractor := range tgt.Extractors {
+		if extractor.NeedsBody() {
+			return true
+		}
+	}
+	for _, assertion := range tgt.Assertions {
+		if assertion.NeedsBody() {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package korra
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -13,20 +14,9 @@ import (
 	"time"
 )
 
-func TestAttackRate(t *testing.T) {
-	server := httptest.NewServer(
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
-	)
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	rate := uint64(100)
-	atk := NewAttacker()
-	var hits uint64
-	for _ = range atk.Attack(tr, rate, 1*time.Second) {
-		hits++
-	}
-	if got, want := hits, rate; got != want {
-		t.Fatalf("got: %v, want: %v", rate, hits)
-	}
+// hit sends a request for the target, as a session would
+func hit(atk *Attacker, tgt *Target) *Result {
+	return atk.Hit(context.Background(), func() (*Target, error) { return tgt, nil }, time.Now(), 1, NewVariables(nil))
 }
 
 func TestTLSConfig(t *testing.T) {
@@ -43,10 +33,10 @@ func TestRedirects(t *testing.T) {
 			http.Redirect(w, r, "/redirect", 302)
 		}),
 	)
+	defer server.Close()
 	redirects := 2
 	atk := NewAttacker(Redirects(redirects))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	res := atk.hit(tr, time.Now())
+	res := hit(atk, &Target{Method: "GET", URL: server.URL})
 	want := fmt.Sprintf("stopped after %d redirects", redirects)
 	if got := res.Error; !strings.HasSuffix(got, want) {
 		t.Fatalf("want: '%v' in '%v'", want, got)
@@ -59,9 +49,9 @@ func TestNoFollow(t *testing.T) {
 			http.Redirect(w, r, "/redirect-here", 302)
 		}),
 	)
+	defer server.Close()
 	atk := NewAttacker(Redirects(NoFollow))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	if res := atk.hit(tr, time.Now()); res.Error != "" {
+	if res := hit(atk, &Target{Method: "GET", URL: server.URL}); res.Error != "" {
 		t.Fatalf("got err: %v", res.Error)
 	}
 }
@@ -69,15 +59,14 @@ func TestNoFollow(t *testing.T) {
 func TestTimeout(t *testing.T) {
 	server := httptest.NewServer(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			<-time.After(20 * time.Millisecond)
+			<-time.After(200 * time.Millisecond)
 		}),
 	)
+	defer server.Close()
 	atk := NewAttacker(Timeout(10 * time.Millisecond))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	res := atk.hit(tr, time.Now())
-	want := "net/http: timeout awaiting response headers"
-	if got := res.Error; !strings.HasSuffix(got, want) {
-		t.Fatalf("want: '%v' in '%v'", want, got)
+	res := hit(atk, &Target{Method: "GET", URL: server.URL})
+	if got := strings.ToLower(res.Error); res.Code != 0 || !strings.Contains(got, "timeout") && !strings.Contains(got, "timed out") {
+		t.Fatalf("want a timeout, got %d '%v'", res.Code, res.Error)
 	}
 }
 
@@ -89,15 +78,15 @@ func TestLocalAddr(t *testing.T) {
 	server := httptest.NewServer(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if got, _, err := net.SplitHostPort(r.RemoteAddr); err != nil {
-				t.Fatal(err)
+				t.Error(err)
 			} else if want := addr.String(); got != want {
-				t.Fatalf("wrong source address. got %v, want: %v", got, want)
+				t.Errorf("wrong source address. got %v, want: %v", got, want)
 			}
 		}),
 	)
+	defer server.Close()
 	atk := NewAttacker(LocalAddr(*addr))
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	atk.hit(tr, time.Now())
+	hit(atk, &Target{Method: "GET", URL: server.URL})
 }
 
 func TestKeepAlive(t *testing.T) {
@@ -117,9 +106,9 @@ func TestStatusCodeErrors(t *testing.T) {
 			w.WriteHeader(http.StatusBadRequest)
 		}),
 	)
+	defer server.Close()
 	atk := NewAttacker()
-	tr := NewStaticTargeter(&Target{Method: "GET", URL: server.URL})
-	res := atk.hit(tr, time.Now())
+	res := hit(atk, &Target{Method: "GET", URL: server.URL})
 	if got, want := res.Error, "400 Bad Request"; got != want {
 		t.Fatalf("got: %v, want: %v", got, want)
 	}
@@ -128,7 +117,7 @@ func TestStatusCodeErrors(t *testing.T) {
 func TestBadTargeterError(t *testing.T) {
 	atk := NewAttacker()
 	tr := func() (*Target, error) { return nil, io.EOF }
-	res := atk.hit(tr, time.Now())
+	res := atk.Hit(context.Background(), tr, time.Now(), 1, NewVariables(nil))
 	if got, want := res.Error, io.EOF.Error(); got != want {
 		t.Fatalf("got: %v, want: %v", got, want)
 	}
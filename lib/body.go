@@ -0,0 +1,100 @@
+package korra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// MaxBody returns a functional option which caps how much of each response
+// body the Attacker reads, in bytes as sent (so before decompressing); the
+// rest is left unread, and the result marked Truncated. 0 reads it all.
+func MaxBody(n int64) func(*Attacker) {
+	return func(a *Attacker) {
+		a.maxBody = n
+	}
+}
+
+// acceptGzip asks for a gzipped response, just as http.Transport does when
+// left to handle compression itself, returning true if it did. We do it
+// here so we can count the bytes before and after decompressing.
+func acceptGzip(request *http.Request) bool {
+	if request.Header.Get("Accept-Encoding") != "" || request.Header.Get("Range") != "" || request.Method == "HEAD" {
+		return false
+	}
+	request.Header.Set("Accept-Encoding", "gzip")
+	return true
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	in    io.Reader
+	count uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.in.Read(p)
+	c.count += uint64(n)
+	return n, err
+}
+
+// readBody reads the response body to the end (or the cap), counting its
+// bytes as sent and once decompressed, returning it only if keep is set and
+// recording the response on the capture if there is one. Decompressed
+// responses look just like those http.Transport decompresses.
+func (a *Attacker) readBody(response *http.Response, gzipped, keep bool, capture *Capture, result *Result) ([]byte, error) {
+	var in io.Reader = response.Body
+	if a.maxBody > 0 {
+		in = io.LimitReader(in, a.maxBody)
+	}
+	sent := &countingReader{in: in}
+	decoded := sent
+	if gzipped && response.Header.Get("Content-Encoding") == "gzip" {
+		unzipped, err := gzip.NewReader(sent)
+		if err == io.EOF {
+			unzipped, err = nil, nil // empty body
+		} else if err != nil && !a.truncated(response, sent) {
+			return nil, err
+		}
+		if unzipped != nil {
+			decoded = &countingReader{in: unzipped}
+		}
+		response.Header.Del("Content-Encoding")
+		response.Header.Del("Content-Length")
+		response.ContentLength = -1
+		response.Uncompressed = true
+	}
+
+	var body bytes.Buffer
+	outs := []io.Writer{ioutil.Discard}
+	if keep {
+		outs = append(outs, &body)
+	}
+	kept := &limitedBuffer{max: a.captureBody}
+	if capture != nil {
+		outs = append(outs, kept)
+	}
+	_, err := io.Copy(io.MultiWriter(outs...), decoded)
+	result.BytesIn = sent.count
+	result.BytesUncompressed = decoded.count
+	if result.Truncated = a.truncated(response, sent); result.Truncated {
+		err = nil // a cut-off gzip stream is expected
+	}
+	if capture != nil {
+		capture.Code, capture.Status, capture.ResponseHeader = uint16(response.StatusCode), response.Status, response.Header
+		capture.ResponseBody = kept.Bytes()
+		capture.Truncated = capture.Truncated || kept.truncated || result.Truncated
+	}
+	return body.Bytes(), err
+}
+
+// truncated returns true if there's more of the body than the cap allowed
+func (a *Attacker) truncated(response *http.Response, sent *countingReader) bool {
+	if a.maxBody <= 0 || int64(sent.count) < a.maxBody {
+		return false
+	}
+	n, _ := response.Body.Read(make([]byte, 1))
+	return n > 0
+}
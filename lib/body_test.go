@@ -0,0 +1,90 @@
+package korra
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHitReadsBody(t *testing.T) {
+	text := strings.Repeat("hello, world ", 1000)
+	var zipped bytes.Buffer
+	zipper := gzip.NewWriter(&zipped)
+	zipper.Write([]byte(text))
+	zipper.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(zipped.Bytes())
+		} else {
+			w.Write([]byte(text))
+		}
+		w.(http.Flusher).Flush() // so it's chunked, without a Content-Length
+	}))
+	defer server.Close()
+
+	hit := func(atk *Attacker, header http.Header) *Result {
+		tr := func() (*Target, error) { return &Target{Method: "GET", URL: server.URL, Header: header}, nil }
+		return atk.Hit(context.Background(), tr, time.Now(), 1, NewVariables(nil))
+	}
+
+	atk := NewAttacker()
+	result := hit(atk, http.Header{})
+	if result.Error != "" {
+		t.Fatal(result.Error)
+	}
+	if result.BytesIn != uint64(zipped.Len()) || result.BytesUncompressed != uint64(len(text)) {
+		t.Errorf("want %d bytes in, %d uncompressed, got %d and %d", zipped.Len(), len(text), result.BytesIn, result.BytesUncompressed)
+	}
+	if result = hit(atk, http.Header{}); !result.Reused {
+		t.Error("want connection reused once the body is read")
+	}
+	plain := hit(atk, http.Header{"Accept-Encoding": []string{"identity"}})
+	if plain.BytesIn != uint64(len(text)) || plain.BytesUncompressed != uint64(len(text)) {
+		t.Errorf("want %d bytes in uncompressed, got %d and %d", len(text), plain.BytesIn, plain.BytesUncompressed)
+	}
+
+	capped := hit(NewAttacker(MaxBody(50)), http.Header{})
+	if capped.Error != "" || !capped.Truncated || capped.BytesIn != 50 {
+		t.Errorf("want 50 bytes of a truncated body without error, got %+v", capped)
+	}
+}
+
+func TestHitBodyErrors(t *testing.T) {
+	stall := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stall" {
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-stall
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(502)
+		w.Write([]byte("not gzip at all"))
+	}))
+	defer server.Close()
+	defer close(stall) // before closing the server, which waits on the handler
+	hit := func(atk *Attacker, path string) *Result {
+		tr := func() (*Target, error) { return &Target{Method: "GET", URL: server.URL + path}, nil }
+		return atk.Hit(context.Background(), tr, time.Now(), 1, NewVariables(nil))
+	}
+
+	if result := hit(NewAttacker(), "/"); result.Code != 502 || result.Error == "" {
+		t.Errorf("want 502 kept along with the error reading the body, got %+v", result)
+	}
+
+	started := time.Now()
+	result := hit(NewAttacker(Timeout(200*time.Millisecond)), "/stall")
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("want the timeout to cover reading the body, took %s", elapsed)
+	}
+	if result.Code != 200 || result.Error != "Timed out after 200ms" {
+		t.Errorf("want 200 that timed out, got %d '%s'", result.Code, result.Error)
+	}
+}
@@ -0,0 +1,155 @@
+package korra
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// CapturePolicy says which requests a session saves in full -- headers and
+// the start of each body, for both the request and the response -- to its
+// capture file, for working out what went wrong.
+type CapturePolicy struct {
+	Failures bool    // capture every request that failed
+	Sample   float64 // fraction (0-1) of all requests to capture
+	MaxBody  int     // bytes of each body to keep, 0 for just the headers
+}
+
+// Capture is a request and its response, saved for debugging
+type Capture struct {
+	Session        string
+	Line           string // position of the action in the script, like "12" or "login.txt:3"
+	Iteration      int
+	Timestamp      time.Time
+	Latency        time.Duration
+	Method         string
+	URL            string
+	RequestHeader  http.Header
+	RequestBody    []byte
+	Code           uint16
+	Status         string
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	Truncated      bool // one of the bodies was longer than was kept
+	Error          string
+}
+
+// CapturePath returns the file captures are written to for a session
+// writing results to the given path
+func CapturePath(resultsPath string) string {
+	return strings.TrimSuffix(resultsPath, ".bin") + ".capture"
+}
+
+// captures returns true if the result's capture should be kept
+func (policy *CapturePolicy) captures(result *Result, random float64) bool {
+	return (policy.Failures && result.Failed()) || random < policy.Sample
+}
+
+// ReadCaptures calls fn with every capture in the file until it's done or
+// fn returns an error
+func ReadCaptures(in io.Reader, fn func(*Capture) error) error {
+	decoder := gob.NewDecoder(in)
+	for {
+		var capture Capture
+		if err := decoder.Decode(&capture); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&capture); err != nil {
+			return err
+		}
+	}
+}
+
+// captureWriter writes captures to a file, created when the first one is
+// written so sessions without any don't leave empty files around
+type captureWriter struct {
+	Name    string
+	Count   int
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder *gob.Encoder
+}
+
+func (w *captureWriter) add(capture *Capture) error {
+	if w.file == nil {
+		file, err := os.Create(w.Name)
+		if err != nil {
+			return err
+		}
+		w.file = file
+		w.buffer = bufio.NewWriter(file)
+		w.encoder = gob.NewEncoder(w.buffer)
+	}
+	if err := w.encoder.Encode(capture); err != nil {
+		return err
+	}
+	w.Count += 1
+	return nil
+}
+
+func (w *captureWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.buffer.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// startCapture records the request, if the attacker is capturing
+func (a *Attacker) startCapture(request *http.Request) *Capture {
+	if !a.capturing {
+		return nil
+	}
+	capture := &Capture{Method: request.Method, URL: request.URL.String(), RequestHeader: request.Header}
+	if request.GetBody != nil {
+		if body, err := request.GetBody(); err == nil {
+			kept := &limitedBuffer{max: a.captureBody}
+			io.Copy(kept, body)
+			body.Close()
+			capture.RequestBody, capture.Truncated = kept.Bytes(), kept.truncated
+		}
+	}
+	return capture
+}
+
+// limitedBuffer keeps the first max bytes written to it, and throws away
+// the rest
+type limitedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - len(b.buf); room < len(p) {
+		b.buf = append(b.buf, p[:room]...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf
+}
+
+// String describes the capture in a line
+func (c *Capture) String() string {
+	status := c.Status
+	if c.Code == 0 {
+		status = "no response"
+	}
+	return fmt.Sprintf("%s line %s (iteration %d) at %s: %s %s => %s in %s",
+		c.Session, c.Line, c.Iteration, c.Timestamp.Format("15:04:05.000"), c.Method, c.URL, status, c.Latency)
+}
@@ -0,0 +1,71 @@
+package korra
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSessionCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			http.Error(w, strings.Repeat("it broke ", 100), 500)
+		}
+	}))
+	defer server.Close()
+	scriptPath, cleanup := writeScript(t, "GET "+server.URL+"/good\nPOST "+server.URL+"/bad\n    X-Test: yes\n")
+	defer cleanup()
+
+	captures := func(policy *CapturePolicy) []*Capture {
+		session, err := NewSession(scriptPath, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Capture = policy
+		os.Remove(CapturePath(session.Output))
+		if err = session.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		in, err := os.Open(CapturePath(session.Output))
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		defer in.Close()
+		var captured []*Capture
+		if err = ReadCaptures(in, func(c *Capture) error { captured = append(captured, c); return nil }); err != nil {
+			t.Fatal(err)
+		}
+		if len(captured) != session.CaptureCount() {
+			t.Errorf("want %d captures counted, got %d", len(captured), session.CaptureCount())
+		}
+		return captured
+	}
+
+	failures := captures(&CapturePolicy{Failures: true, MaxBody: 20})
+	if len(failures) != 1 {
+		t.Fatalf("want 1 capture of the failure, got %d", len(failures))
+	}
+	failure := failures[0]
+	if failure.Session != "script.txt" || failure.Line != "2" || failure.Code != 500 || failure.Error != "500 Internal Server Error" {
+		t.Errorf("want failure from line 2 of script.txt, got %s (%s)", failure, failure.Error)
+	}
+	if failure.RequestHeader.Get("X-Test") != "yes" || string(failure.ResponseBody) != "it broke it broke it" || !failure.Truncated {
+		t.Errorf("want request header and 20 bytes of the response body, got %v and '%s'", failure.RequestHeader, failure.ResponseBody)
+	}
+
+	if all := captures(&CapturePolicy{Sample: 1, MaxBody: 20}); len(all) != 2 {
+		t.Errorf("want every request captured, got %d", len(all))
+	}
+	if none := captures(&CapturePolicy{Sample: 0, MaxBody: 20}); len(none) != 0 {
+		t.Errorf("want no captures, got %d", len(none))
+	}
+	headers := captures(&CapturePolicy{Failures: true})
+	if len(headers) != 1 || headers[0].ResponseHeader.Get("Content-Type") == "" || len(headers[0].ResponseBody) != 0 {
+		t.Errorf("want just the headers of the failure with no body kept, got %+v", headers)
+	}
+}
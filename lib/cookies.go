@@ -0,0 +1,81 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieSeed is a cookie to put in a session's cookie jar before it starts,
+// along with the URL it's set for
+type CookieSeed struct {
+	URL    *url.URL
+	Cookie *http.Cookie
+}
+
+// ReadCookieFile reads cookies from a file in the Netscape cookie format
+// used by curl, wget and most browser export tools -- one cookie per line
+// with the tab-separated fields:
+//
+//    domain  include-subdomains  path  secure  expires  name  value
+//
+// Blank lines and those starting with '#' are skipped, except for curl's
+// '#HttpOnly_' domain prefix.
+func ReadCookieFile(filename string) ([]*CookieSeed, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening cookie file %s: %s", filename, err)
+	}
+	defer in.Close()
+
+	var seeds []*CookieSeed
+	lineNumber := 0
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		lineNumber += 1
+		// only the line ending is trimmed, as an empty value leaves a trailing tab
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = line[10:]
+		} else if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s line %d: expected 7 tab-separated fields, got %d", filename, lineNumber, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: expected unix time for expiration, got '%s'", filename, lineNumber, fields[4])
+		}
+		host := strings.TrimPrefix(fields[0], ".")
+		secure := strings.EqualFold(fields[3], "TRUE")
+		seed := &CookieSeed{
+			URL: &url.URL{Scheme: "http", Host: host, Path: fields[2]},
+			Cookie: &http.Cookie{
+				Name:     fields[5],
+				Value:    fields[6],
+				Path:     fields[2],
+				Secure:   secure,
+				HttpOnly: httpOnly,
+			},
+		}
+		if secure {
+			seed.URL.Scheme = "https"
+		}
+		if strings.EqualFold(fields[1], "TRUE") {
+			seed.Cookie.Domain = host
+		}
+		if expires > 0 {
+			seed.Cookie.Expires = time.Unix(expires, 0)
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds, scanner.Err()
+}
@@ -0,0 +1,74 @@
+package korra
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadCookieFile(t *testing.T) {
+	cookief, err := ioutil.TempFile("", "korra-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cookief.Name())
+	cookief.WriteString("# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc123\n" +
+		"#HttpOnly_api.example.com\tFALSE\t/v1\tTRUE\t2000000000\ttoken\txyz\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tconsent\t\r\n")
+	cookief.Close()
+
+	seeds, err := ReadCookieFile(cookief.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) != 3 {
+		t.Fatalf("want 3 cookies, got %d", len(seeds))
+	}
+	if got := seeds[0]; got.URL.String() != "http://example.com/" || got.Cookie.Domain != "example.com" || got.Cookie.Value != "abc123" {
+		t.Errorf("bad first cookie: %s %#v", got.URL, got.Cookie)
+	}
+	if got := seeds[1]; got.URL.String() != "https://api.example.com/v1" || !got.Cookie.HttpOnly || !got.Cookie.Secure {
+		t.Errorf("bad second cookie: %s %#v", got.URL, got.Cookie)
+	}
+	if got := seeds[2]; got.Cookie.Name != "consent" || got.Cookie.Value != "" {
+		t.Errorf("want cookie with empty value, got %#v", got.Cookie)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/login" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123"})
+			} else if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc123" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}),
+	)
+	defer server.Close()
+	hit := func(atk *Attacker, path string) *Result {
+		tr := func() (*Target, error) { return &Target{Method: "GET", URL: server.URL + path}, nil }
+		return atk.Hit(context.Background(), tr, time.Now(), 1, NewVariables(nil))
+	}
+
+	atk := NewAttacker(Cookies(true))
+	hit(atk, "/login")
+	if res := hit(atk, "/home"); res.Code != 200 {
+		t.Errorf("want: 200 with cookie jar, got: %d", res.Code)
+	}
+	atk.ClearCookies()
+	if res := hit(atk, "/home"); res.Code != 401 {
+		t.Errorf("want: 401 after clearing cookies, got: %d", res.Code)
+	}
+
+	atk = NewAttacker()
+	hit(atk, "/login")
+	if res := hit(atk, "/home"); res.Code != 401 {
+		t.Errorf("want: 401 without cookie jar, got: %d", res.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package korra
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ReadDataFile reads the rows used to create sessions from a template
+// script, each a map of column name to value. Files ending in '.jsonl' or
+// '.ndjson' have one JSON object per line, whose top-level fields are the
+// columns (values other than strings and numbers are kept as JSON);
+// anything else is read as CSV, with the column names in the first row.
+// Every column name must be usable as a variable.
+func ReadDataFile(filename string) ([]map[string]string, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening data file %s: %s", filename, err)
+	}
+	defer in.Close()
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jsonl", ".ndjson":
+		return readJSONLines(filename, in)
+	}
+	return readCSV(filename, in)
+}
+
+func readCSV(filename string, in io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(in)
+	reader.TrimLeadingSpace = true
+	columns, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: expected a header row with column names", filename)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	for idx, column := range columns {
+		if columns[idx] = strings.TrimSpace(column); !IsVariableName(columns[idx]) {
+			return nil, fmt.Errorf("%s: column '%s' can't be used as a variable name", filename, column)
+		}
+	}
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		row := make(map[string]string)
+		for idx, column := range columns {
+			row[column] = record[idx]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readJSONLines(filename string, in io.Reader) ([]map[string]string, error) {
+	var rows []map[string]string
+	lineNumber := 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNumber += 1
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return nil, fmt.Errorf("%s line %d: expected a JSON object: %s", filename, lineNumber, err)
+		}
+		row := make(map[string]string)
+		for name, raw := range fields {
+			if !IsVariableName(name) {
+				return nil, fmt.Errorf("%s line %d: field '%s' can't be used as a variable name", filename, lineNumber, name)
+			}
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				value = string(raw) // numbers, booleans, objects...
+			}
+			row[name] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
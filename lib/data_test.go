@@ -0,0 +1,38 @@
+package korra
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReadDataFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "korra-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	csvFile, jsonFile := path.Join(dir, "users.csv"), path.Join(dir, "users.jsonl")
+	ioutil.WriteFile(csvFile, []byte("user_id, email\n1,\"alice@example.com\"\n2,bob@example.com\n"), 0644)
+	ioutil.WriteFile(jsonFile, []byte(`{"user_id": 1, "email": "alice@example.com"}`+"\n\n"+`{"user_id": 2, "email": "bob@example.com", "admin": true}`+"\n"), 0644)
+
+	for _, filename := range []string{csvFile, jsonFile} {
+		rows, err := ReadDataFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("%s: want 2 rows, got %d", filename, len(rows))
+		}
+		if rows[0]["user_id"] != "1" || rows[0]["email"] != "alice@example.com" || rows[1]["email"] != "bob@example.com" {
+			t.Errorf("%s: got %v", filename, rows)
+		}
+	}
+
+	badFile := path.Join(dir, "bad.csv")
+	ioutil.WriteFile(badFile, []byte("user id,email\n1,alice@example.com\n"), 0644)
+	if _, err := ReadDataFile(badFile); err == nil {
+		t.Error("expected error for column that isn't a variable name")
+	}
+}
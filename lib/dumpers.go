@@ -25,15 +25,19 @@ func (f DumperFunc) Dump(r *Result) ([]byte, error) { return f(r) }
 func (f HeaderFunc) Header() []byte                 { return f() }
 
 var DumpCSVHeader HeaderFunc = func() []byte {
-	return []byte("Timestamp\tStatus\tMethod\tPath\tRequestCount\tLatency\tBytes Out\tBytes In\tError\n")
+	return []byte("Timestamp\tStatus\tMethod\tPath\tRequestCount\tLatency\tBytes Out\tBytes In\tError\tBytes Uncompressed\tDNS\tConnect\tTLS\tFirst Byte\tTransfer\tReused\tTruncated\tSession\tLine\tStep\tIteration\tBranch\tRepeat\n")
 }
 
-// DumpCSV dumps a Result as a CSV record with six columns.
-// The columns are: unix timestamp in ns since epoch, http status code,
-// request latency in ns, bytes out, bytes in, and lastly the error.
+// DumpCSV dumps a Result as a tab-separated record. The columns are: unix
+// timestamp in ns since epoch, http status code, method, path, request
+// count, request latency in ns, bytes out, bytes in, and the error; after
+// those come the bytes in uncompressed, the DNS, connect, TLS, first byte
+// and transfer phases in ns, whether the connection was reused, whether the
+// body was truncated, and the session, script line, step, iteration, CHOOSE
+// branch and REPEAT iteration that made the request.
 var DumpCSV DumperFunc = func(r *Result) ([]byte, error) {
 	var buf bytes.Buffer
-	_, err := fmt.Fprintf(&buf, "%d\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+	_, err := fmt.Fprintf(&buf, "%d\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%t\t%t\t%s\t%s\t%s\t%d\t%s\t%d\n",
 		r.Timestamp.UnixNano(),
 		r.Code,
 		r.Method,
@@ -43,6 +47,20 @@ var DumpCSV DumperFunc = func(r *Result) ([]byte, error) {
 		r.BytesOut,
 		r.BytesIn,
 		r.Error,
+		r.BytesUncompressed,
+		r.DNS.Nanoseconds(),
+		r.Connect.Nanoseconds(),
+		r.TLS.Nanoseconds(),
+		r.FirstByte.Nanoseconds(),
+		r.Transfer.Nanoseconds(),
+		r.Reused,
+		r.Truncated,
+		r.Session,
+		r.Line,
+		r.Step,
+		r.Iteration,
+		r.Branch,
+		r.Repeat,
 	)
 	return buf.Bytes(), err
 }
@@ -0,0 +1,70 @@
+package korra
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpCSV(t *testing.T) {
+	header := strings.Split(strings.TrimSuffix(string(DumpCSVHeader()), "\n"), "\t")
+	// the original columns stay where they were, so anything reading them
+	// by position still works
+	original := []string{"Timestamp", "Status", "Method", "Path", "RequestCount", "Latency", "Bytes Out", "Bytes In", "Error"}
+	for idx, name := range original {
+		if header[idx] != name {
+			t.Errorf("want column %d to be %s, got %s", idx, name, header[idx])
+		}
+	}
+
+	result := &Result{
+		Timestamp:         time.Unix(0, 1000),
+		Code:              500,
+		Method:            "GET",
+		Path:              "/cart",
+		RequestCount:      1,
+		Latency:           20 * time.Millisecond,
+		BytesOut:          10,
+		BytesIn:           20,
+		Error:             "500 Internal Server Error",
+		BytesUncompressed: 40,
+		DNS:               time.Millisecond,
+		Reused:            true,
+		Session:           "user_1",
+		Line:              "3",
+		Step:              "checkout",
+		Iteration:         2,
+		Branch:            "guest",
+		Repeat:            4,
+	}
+	dumped, err := DumpCSV(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := strings.Split(strings.TrimSuffix(string(dumped), "\n"), "\t")
+	if len(record) != len(header) {
+		t.Fatalf("want %d columns, got %d: %v", len(header), len(record), record)
+	}
+	want := map[string]string{
+		"Timestamp":          "1000",
+		"Status":             "500",
+		"Path":               "/cart",
+		"Latency":            "20000000",
+		"Bytes In":           "20",
+		"Error":              "500 Internal Server Error",
+		"Bytes Uncompressed": "40",
+		"DNS":                "1000000",
+		"Reused":             "true",
+		"Truncated":          "false",
+		"Session":            "user_1",
+		"Step":               "checkout",
+		"Iteration":          "2",
+		"Branch":             "guest",
+		"Repeat":             "4",
+	}
+	for idx, name := range header {
+		if value, ok := want[name]; ok && record[idx] != value {
+			t.Errorf("want %s to be %q, got %q", name, value, record[idx])
+		}
+	}
+}
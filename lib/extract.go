@@ -0,0 +1,167 @@
+package korra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Extractor pulls a single value out of a response and names it so later
+// actions in the session can reference it as ${name}. It's declared in a
+// script underneath an HTTP command:
+//
+//    EXTRACT name=source
+//
+// where source is one of:
+//
+// * $.path.to[0].value: JSON path into the response body
+// * header:Header-Name: value of a response header
+// * status: the response status code
+// * regex:pattern: first capture group (or entire match) in the body
+type Extractor struct {
+	Name    string
+	Source  string
+	header  string
+	pattern *regexp.Regexp
+}
+
+func NewExtractor(spec string) (*Extractor, error) {
+	pieces := strings.SplitN(spec, "=", 2)
+	if len(pieces) != 2 {
+		return nil, fmt.Errorf("Expected name=source, got '%s'", spec)
+	}
+	extractor := &Extractor{Name: strings.TrimSpace(pieces[0]), Source: strings.TrimSpace(pieces[1])}
+	if extractor.Name == "" || extractor.Source == "" {
+		return nil, fmt.Errorf("Expected non-blank name and source, got '%s'", spec)
+	}
+	switch {
+	case extractor.Source == "status":
+	case strings.HasPrefix(extractor.Source, "$"):
+		if _, err := parseJSONPath(extractor.Source); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(extractor.Source, "header:"):
+		if extractor.header = strings.TrimSpace(extractor.Source[7:]); extractor.header == "" {
+			return nil, fmt.Errorf("Expected header name in '%s'", extractor.Source)
+		}
+	case strings.HasPrefix(extractor.Source, "regex:"):
+		pattern, err := regexp.Compile(extractor.Source[6:])
+		if err != nil {
+			return nil, fmt.Errorf("Bad regex in '%s': %s", extractor.Source, err)
+		}
+		extractor.pattern = pattern
+	default:
+		return nil, fmt.Errorf("Unknown source '%s'; expected status, $.json.path, header:Name or regex:pattern", extractor.Source)
+	}
+	return extractor, nil
+}
+
+// NeedsBody returns true if the extractor reads the response body
+func (e *Extractor) NeedsBody() bool {
+	return e.pattern != nil || strings.HasPrefix(e.Source, "$")
+}
+
+// Extract returns the value from the response (and its already-read body)
+// described by this extractor's source.
+func (e *Extractor) Extract(response *http.Response, body []byte) (string, error) {
+	switch {
+	case e.Source == "status":
+		return strconv.Itoa(response.StatusCode), nil
+	case e.header != "":
+		if value := response.Header.Get(e.header); value != "" {
+			return value, nil
+		}
+		return "", fmt.Errorf("no header %s in response", e.header)
+	case e.pattern != nil:
+		matches := e.pattern.FindSubmatch(body)
+		if matches == nil {
+			return "", fmt.Errorf("no match for %s in body", e.pattern)
+		} else if len(matches) > 1 {
+			return string(matches[1]), nil
+		}
+		return string(matches[0]), nil
+	}
+	return jsonPathValue(body, e.Source)
+}
+
+func (e *Extractor) String() string {
+	return fmt.Sprintf("%s=%s", e.Name, e.Source)
+}
+
+var jsonPathIndex = regexp.MustCompile(`^([^\[]*)((?:\[\d+\])*)$`)
+
+// parseJSONPath splits a path like $.data.items[0].id into its steps, with
+// object keys as strings and array indexes as ints.
+func parseJSONPath(path string) ([]interface{}, error) {
+	var steps []interface{}
+	if path == "$" {
+		return steps, nil
+	}
+	if !strings.HasPrefix(path, "$.") && !strings.HasPrefix(path, "$[") {
+		return nil, fmt.Errorf("Bad JSON path '%s': expected to start with '$.'", path)
+	}
+	for _, piece := range strings.Split(strings.TrimPrefix(path[1:], "."), ".") {
+		matches := jsonPathIndex.FindStringSubmatch(piece)
+		if matches == nil || (matches[1] == "" && matches[2] == "") {
+			return nil, fmt.Errorf("Bad JSON path '%s' at '%s'", path, piece)
+		}
+		if matches[1] != "" {
+			steps = append(steps, matches[1])
+		}
+		for _, index := range strings.Split(matches[2], "]") {
+			if index == "" {
+				continue
+			}
+			idx, _ := strconv.Atoi(index[1:])
+			steps = append(steps, idx)
+		}
+	}
+	return steps, nil
+}
+
+func jsonPathValue(body []byte, path string) (string, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err = decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("cannot read body as JSON: %s", err)
+	}
+	for _, step := range steps {
+		switch key := step.(type) {
+		case string:
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("no value at %s: '%s' is not in an object", path, key)
+			}
+			if doc, ok = object[key]; !ok {
+				return "", fmt.Errorf("no value at %s: missing '%s'", path, key)
+			}
+		case int:
+			array, ok := doc.([]interface{})
+			if !ok || key >= len(array) {
+				return "", fmt.Errorf("no value at %s: index %d out of range", path, key)
+			}
+			doc = array[key]
+		}
+	}
+	switch value := doc.(type) {
+	case nil:
+		return "", fmt.Errorf("no value at %s: null", path)
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+	encoded, err := json.Marshal(doc)
+	return string(encoded), err
+}
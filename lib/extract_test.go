@@ -0,0 +1,44 @@
+package korra
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExtractorSources(t *testing.T) {
+	response := &http.Response{StatusCode: 201, Header: http.Header{}}
+	response.Header.Set("Location", "/things/42")
+	body := []byte(`{"data": {"id": 42, "name": "foo", "tags": ["a", "b"]}, "ok": true}`)
+
+	for spec, want := range map[string]string{
+		"id=$.data.id":               "42",
+		"name=$.data.name":           "foo",
+		"tag=$.data.tags[1]":         "b",
+		"ok=$.ok":                    "true",
+		"loc=header:Location":        "/things/42",
+		"code=status":                "201",
+		`name=regex:"name": "(\w+)"`: "foo",
+	} {
+		extractor, err := NewExtractor(spec)
+		if err != nil {
+			t.Fatalf("%s: %s", spec, err)
+		}
+		if got, err := extractor.Extract(response, body); err != nil {
+			t.Errorf("%s: %s", spec, err)
+		} else if got != want {
+			t.Errorf("%s: want: %s, got: %s", spec, want, got)
+		}
+	}
+}
+
+func TestExtractorErrors(t *testing.T) {
+	for _, spec := range []string{"id", "=status", "id=body", "id=data.id", "id=regex:("} {
+		if _, err := NewExtractor(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+	extractor, _ := NewExtractor("id=$.data.missing")
+	if _, err := extractor.Extract(&http.Response{}, []byte(`{"data": {}}`)); err == nil {
+		t.Errorf("expected error for missing value")
+	}
+}
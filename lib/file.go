@@ -22,25 +22,23 @@ func File(name string, create bool) (*os.File, error) {
 }
 
 func GlobInputs(spec string) []string {
-	info, err := os.Stat(spec)
-	if err == nil && info.IsDir() {
-		spec = fmt.Sprintf("%s/*.txt", spec)
-	}
-	var files []string
-	if strings.Contains(spec, "*") {
-		if files, err = filepath.Glob(spec); err != nil {
-			panic(fmt.Sprintf("Bad glob %s: %s", spec, err))
-		}
-	} else {
-		files = strings.Split(spec, ",")
-	}
-	return files
+	return globFiles(spec, "txt")
 }
 
 func GlobResults(spec string) []string {
+	return globFiles(spec, "bin")
+}
+
+func GlobCaptures(spec string) []string {
+	return globFiles(spec, "capture")
+}
+
+// globFiles returns the files matching the glob, or in the comma-separated
+// list, or with the extension in the directory
+func globFiles(spec, ext string) []string {
 	info, err := os.Stat(spec)
 	if err == nil && info.IsDir() {
-		spec = fmt.Sprintf("%s/*.bin", spec)
+		spec = fmt.Sprintf("%s/*.%s", spec, ext)
 	}
 	var files []string
 	if strings.Contains(spec, "*") {
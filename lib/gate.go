@@ -0,0 +1,51 @@
+package korra
+
+import "sync"
+
+// Gate lets a run be paused and resumed: sessions sharing a gate wait at it
+// before every action while it's closed.
+type Gate struct {
+	lock   sync.Mutex
+	open   chan struct{} // closed while the gate is open
+	paused bool
+}
+
+func NewGate() *Gate {
+	open := make(chan struct{})
+	close(open)
+	return &Gate{open: open}
+}
+
+// Pause closes the gate, so sessions wait once they finish what they're
+// doing
+func (g *Gate) Pause() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !g.paused {
+		g.paused = true
+		g.open = make(chan struct{})
+	}
+}
+
+// Resume opens the gate, letting every waiting session continue
+func (g *Gate) Resume() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.paused {
+		g.paused = false
+		close(g.open)
+	}
+}
+
+func (g *Gate) Paused() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.paused
+}
+
+// Open returns a channel that's closed once the gate is open
+func (g *Gate) Open() <-chan struct{} {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.open
+}
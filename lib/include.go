@@ -0,0 +1,121 @@
+package korra
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var includeCommand = regexp.MustCompile("^INCLUDE(\\s|$)")
+
+// expandIncludes replaces every INCLUDE action with the actions from the
+// fragment it names, recursively. A fragment is a script like any other,
+// found relative to the directory of the file that includes it (just like
+// '@body' references), and can be given parameters:
+//
+//    INCLUDE fragments/login.txt user=${user} password=secret
+//
+// The parameters are bound to the fragment's actions (see Scope), so every
+// '${user}' and '${password}' in the fragment -- its @body files included
+// -- resolves to the given value when the session runs, and any other
+// variable references resolve from the session's variables as usual. An
+// INCLUDE that can't be expanded -- bad arguments, a missing fragment, or
+// one that includes itself somewhere down the line -- stays in place with
+// its `Error` set.
+func expandIncludes(actions []*SessionAction, scriptPath string) ([]*SessionAction, error) {
+	return expandIncludesFrom(actions, path.Dir(scriptPath), []string{absPath(scriptPath)})
+}
+
+func expandIncludesFrom(actions []*SessionAction, dir string, including []string) ([]*SessionAction, error) {
+	var expanded []*SessionAction
+	for _, action := range actions {
+		if !includeCommand.MatchString(action.Raw) {
+			expanded = append(expanded, action)
+			continue
+		}
+		fragment, err := action.includeFragment(dir, including)
+		if err != nil {
+			return nil, err // IO error reading the fragment
+		}
+		expanded = append(expanded, fragment...)
+	}
+	return expanded, nil
+}
+
+// includeFragment reads the actions from the fragment named by this INCLUDE
+// action, or returns this action marked with what's wrong
+func (action *SessionAction) includeFragment(dir string, including []string) ([]*SessionAction, error) {
+	fields := strings.Fields(action.Raw)
+	if len(fields) < 2 {
+		action.BadLine(0, "Expected fragment file as argument to INCLUDE")
+		return []*SessionAction{action}, nil
+	}
+	params := make(map[string]string)
+	for _, param := range fields[2:] {
+		tokens := strings.SplitN(param, "=", 2)
+		if len(tokens) != 2 || !IsVariableName(tokens[0]) {
+			action.BadLine(0, fmt.Sprintf("Expected name=value parameters to INCLUDE, got '%s'", param))
+			return []*SessionAction{action}, nil
+		}
+		params[tokens[0]] = tokens[1]
+	}
+
+	fragmentPath := path.Join(dir, fields[1])
+	fragmentAbs := absPath(fragmentPath)
+	for idx, file := range including {
+		if file == fragmentAbs {
+			cycle := append(append([]string{}, including[idx:]...), fragmentAbs)
+			for i := range cycle {
+				cycle[i] = path.Base(cycle[i])
+			}
+			action.BadLine(0, fmt.Sprintf("INCLUDE cycle: %s", strings.Join(cycle, " -> ")))
+			return []*SessionAction{action}, nil
+		}
+	}
+	reader, err := scriptFile(fragmentPath)
+	if err != nil {
+		action.BadLine(0, fmt.Sprintf("Invalid INCLUDE: %s", err))
+		return []*SessionAction{action}, nil
+	}
+	fragment, err := ScanActions(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+	action.params = params
+	for _, included := range fragment {
+		included.File = fragmentPath
+		included.includedBy = action
+	}
+	return expandIncludesFrom(fragment, path.Dir(fragmentPath), append(including[:len(including):len(including)], fragmentAbs))
+}
+
+// Scope returns the variables the action's references resolve from: vars
+// itself for an action in the script, or for one from a fragment a child of
+// vars holding the parameters given to the INCLUDE, whose own references
+// are resolved from where that INCLUDE is. Parameters aren't passed down to
+// fragments the fragment includes, and one whose value can't be resolved is
+// left out, so references to it are reported as unresolved.
+func (action *SessionAction) Scope(vars *Variables) *Variables {
+	include := action.includedBy
+	if include == nil {
+		return vars
+	}
+	outer := include.Scope(vars)
+	scope := NewVariables(vars)
+	for name, value := range include.params {
+		if expanded, err := outer.Expand(value); err == nil {
+			scope.Set(name, expanded)
+		}
+	}
+	return scope
+}
+
+func absPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return path.Clean(file)
+}
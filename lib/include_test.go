@@ -0,0 +1,123 @@
+package korra
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestScriptInclude(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `GET http://foo/start
+INCLUDE fragments/login.txt user=alice
+GET http://foo/finish
+`)
+	defer cleanup()
+	fragments := path.Join(path.Dir(scriptPath), "fragments")
+	writeFragment(t, fragments, "login.txt", "POST http://foo/login?user=${user}&token=${token}\n\nINCLUDE touch.txt user=${user}\n")
+	writeFragment(t, fragments, "touch.txt", "GET http://foo/touch/${user}\n")
+
+	script, err := NewScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := NewVariables(nil)
+	vars.Set("user", "bob")
+	vars.Set("token", "t1")
+	var urls []string
+	for _, action := range script.Actions {
+		target, err := action.Target.Expand(action.Scope(vars))
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, target.URL)
+	}
+	want := []string{
+		"http://foo/start",
+		"http://foo/login?user=alice&token=t1",
+		"http://foo/touch/alice",
+		"http://foo/finish",
+	}
+	if strings.Join(urls, "|") != strings.Join(want, "|") {
+		t.Errorf("want %v, got %v", want, urls)
+	}
+	if got := script.Actions[2].Position(); got != path.Join(fragments, "touch.txt")+":1" {
+		t.Errorf("want fragment position, got %s", got)
+	}
+}
+
+func TestScriptIncludeBody(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, "INCLUDE fragments/login.txt user=${name}\nPOST http://foo/again\n@login.json\n")
+	defer cleanup()
+	fragments := path.Join(path.Dir(scriptPath), "fragments")
+	writeFragment(t, fragments, "login.txt", "POST http://foo/login\n@login.json\n")
+	writeFragment(t, fragments, "login.json", `{"user": "${user}", "token": "${token}"}`)
+	writeFragment(t, path.Dir(scriptPath), "login.json", `{"user": "${user}"}`)
+
+	script, err := CheckScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := NewVariables(nil)
+	vars.Set("name", "alice")
+	vars.Set("token", "t1")
+	if unresolved := script.CheckReferences(vars); unresolved != 1 || script.Actions[0].Error != nil {
+		t.Errorf("want only the script's own ${user} unresolved, got %d: %v", unresolved, script.Actions[0].Error)
+	}
+
+	target, err := script.Actions[0].Target.Expand(script.Actions[0].Scope(vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := target.Body()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(body)
+	if want := `{"user": "alice", "token": "t1"}`; string(got) != want {
+		t.Errorf("want body %s, got %s", want, got)
+	}
+}
+
+func TestScriptIncludeErrors(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `INCLUDE a.txt
+INCLUDE missing.txt
+INCLUDE a.txt user
+`)
+	defer cleanup()
+	dir := path.Dir(scriptPath)
+	writeFragment(t, dir, "a.txt", "GET http://foo/a\nINCLUDE b.txt\n")
+	writeFragment(t, dir, "b.txt", "FETCH http://foo/b\nINCLUDE a.txt\n")
+
+	script, err := CheckScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errors []string
+	for _, action := range script.Actions {
+		if action.Error != nil {
+			errors = append(errors, action.Error.Error())
+		}
+	}
+	bFile := path.Join(dir, "b.txt")
+	for idx, prefix := range []string{
+		"Line 1 of " + bFile + " (included from line 2 of " + path.Join(dir, "a.txt") + " (included from line 1)): Invalid HTTP method",
+		"Line 2 of " + bFile + " (included from line 2 of " + path.Join(dir, "a.txt") + " (included from line 1)): INCLUDE cycle: a.txt -> b.txt -> a.txt",
+		"Line 2: Invalid INCLUDE",
+		"Line 3: Expected name=value parameters to INCLUDE, got 'user'",
+	} {
+		if idx >= len(errors) || !strings.HasPrefix(errors[idx], prefix) {
+			t.Errorf("want error starting %q, got %v", prefix, errors)
+		}
+	}
+}
+
+func writeFragment(t *testing.T, dir, name, text string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, name), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+package korra
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter caps the rate of requests across every Attacker it's given
+// to. It's a token bucket holding a single token, so requests are spaced
+// evenly rather than sent in bursts; with PerHost every host gets its own
+// bucket, so the cap applies to each host separately.
+type RateLimiter struct {
+	PerSecond float64
+	PerHost   bool
+	interval  time.Duration
+	lock      sync.Mutex
+	next      map[string]time.Time
+}
+
+func NewRateLimiter(perSecond float64, perHost bool) (*RateLimiter, error) {
+	if perSecond <= 0 {
+		return nil, fmt.Errorf("Expected a rate limit above 0, got %.2f", perSecond)
+	}
+	return &RateLimiter{
+		PerSecond: perSecond,
+		PerHost:   perHost,
+		interval:  time.Duration(float64(time.Second) / perSecond),
+		next:      make(map[string]time.Time),
+	}, nil
+}
+
+// Wait blocks until a request to the host may be sent, and returns how long
+// that took; if ctx is cancelled first it returns its error.
+func (l *RateLimiter) Wait(ctx context.Context, host string) (time.Duration, error) {
+	if !l.PerHost {
+		host = ""
+	}
+	l.lock.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.lock.Unlock()
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return time.Since(now), ctx.Err()
+	case <-timer.C:
+		return wait, nil
+	}
+}
+
+func (l *RateLimiter) String() string {
+	if l.PerHost {
+		return fmt.Sprintf("%.2f requests/s per host", l.PerSecond)
+	}
+	return fmt.Sprintf("%.2f requests/s", l.PerSecond)
+}
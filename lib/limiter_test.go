@@ -0,0 +1,50 @@
+package korra
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter(100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var waited time.Duration
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			wait, _ := limiter.Wait(context.Background(), host)
+			lock.Lock()
+			waited += wait
+			lock.Unlock()
+		}([]string{"a", "b"}[i%2])
+	}
+	wg.Wait()
+	// ten requests spaced 10ms apart, waiting 0+10+20...+90ms
+	if elapsed := time.Since(started); elapsed < 85*time.Millisecond {
+		t.Errorf("want 10 requests at 100/s to take about 90ms, took %s", elapsed)
+	}
+	if waited < 400*time.Millisecond {
+		t.Errorf("want about 450ms total wait, got %s", waited)
+	}
+
+	perHost, _ := NewRateLimiter(100, true)
+	perHost.Wait(context.Background(), "a")
+	if wait, _ := perHost.Wait(context.Background(), "b"); wait != 0 {
+		t.Errorf("want no wait for a different host, got %s", wait)
+	}
+	if wait, _ := perHost.Wait(context.Background(), "a"); wait == 0 {
+		t.Error("want a wait for the same host")
+	}
+
+	if _, err := NewRateLimiter(0, false); err == nil {
+		t.Error("expected error for rate of 0")
+	}
+}
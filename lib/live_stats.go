@@ -0,0 +1,239 @@
+package korra
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LiveStats aggregates results from every session as they arrive, keeping
+// enough detail to describe recent windows of time -- the error rate or
+// latency percentiles over the last minute, say -- as well as totals for
+// the whole run. It's a ResultObserver.
+type LiveStats struct {
+	lock        sync.Mutex
+	retain      time.Duration
+	buckets     []*liveBucket // one per second, oldest first
+	consecutive int
+	totals      LiveTotals
+}
+
+// LiveTotals are counts over the whole run so far. Paths are keyed by
+// method and path bucket (e.g. 'GET /users/*'); only the first
+// MaxLiveErrors distinct error messages are counted separately, the rest
+// are lumped together as OtherErrors.
+type LiveTotals struct {
+	Requests     int                 `json:"requests"`
+	Failures     int                 `json:"failures"`
+	ConnErrors   int                 `json:"conn_errors"`
+	BytesIn      uint64              `json:"bytes_in"`
+	BytesOut     uint64              `json:"bytes_out"`
+	StatusCodes  map[int]int         `json:"status_codes"`
+	LatencyTotal time.Duration       `json:"latency_total"`
+	Errors       map[string]int      `json:"errors"`
+	Paths        map[string]LivePath `json:"paths"`
+}
+
+// LivePath are the counts for a method and path bucket
+type LivePath struct {
+	Requests     int           `json:"requests"`
+	Failures     int           `json:"failures"`
+	LatencyTotal time.Duration `json:"latency_total"`
+	LatencyMax   time.Duration `json:"latency_max"`
+}
+
+// Mean returns the mean latency of requests to the path
+func (p LivePath) Mean() time.Duration {
+	if p.Requests == 0 {
+		return 0
+	}
+	return p.LatencyTotal / time.Duration(p.Requests)
+}
+
+const (
+	MaxLiveErrors = 1000
+	OtherErrors   = "(other errors)"
+)
+
+// LiveWindow describes the results that completed in a recent window
+type LiveWindow struct {
+	Duration  time.Duration
+	Requests  int
+	Failures  int
+	latencies []time.Duration
+}
+
+type liveBucket struct {
+	second    int64
+	requests  int
+	failures  int
+	latencies []time.Duration
+}
+
+// NewLiveStats creates stats able to describe windows of up to retain
+func NewLiveStats(retain time.Duration) *LiveStats {
+	return &LiveStats{
+		retain: retain,
+		totals: LiveTotals{
+			StatusCodes: make(map[int]int),
+			Errors:      make(map[string]int),
+			Paths:       make(map[string]LivePath),
+		},
+	}
+}
+
+// Observe adds the result to the stats, in the second it completed
+func (s *LiveStats) Observe(session string, r *Result) {
+	second := r.Timestamp.Add(r.Latency).Unix()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.totals.Requests += 1
+	s.totals.StatusCodes[int(r.Code)] += 1
+	s.totals.BytesIn += r.BytesIn
+	s.totals.BytesOut += r.BytesOut
+	s.totals.LatencyTotal += r.Latency
+	pathKey := r.Method + " " + bucketPath(r.Path)
+	path := s.totals.Paths[pathKey]
+	path.Requests += 1
+	path.LatencyTotal += r.Latency
+	if r.Latency > path.LatencyMax {
+		path.LatencyMax = r.Latency
+	}
+	if r.Failed() {
+		s.totals.Failures += 1
+		path.Failures += 1
+		if _, ok := s.totals.Errors[r.Error]; ok || len(s.totals.Errors) < MaxLiveErrors {
+			s.totals.Errors[r.Error] += 1
+		} else {
+			s.totals.Errors[OtherErrors] += 1
+		}
+	}
+	s.totals.Paths[pathKey] = path
+	if isConnError(r) {
+		s.totals.ConnErrors += 1
+		s.consecutive += 1
+	} else {
+		s.consecutive = 0
+	}
+
+	bucket := s.bucket(second)
+	bucket.requests += 1
+	bucket.latencies = append(bucket.latencies, r.Latency)
+	if r.Failed() {
+		bucket.failures += 1
+	}
+	s.expire(second)
+}
+
+// bucket finds or creates the bucket for the second, keeping them in order
+func (s *LiveStats) bucket(second int64) *liveBucket {
+	idx := sort.Search(len(s.buckets), func(i int) bool { return s.buckets[i].second >= second })
+	if idx < len(s.buckets) && s.buckets[idx].second == second {
+		return s.buckets[idx]
+	}
+	bucket := &liveBucket{second: second}
+	s.buckets = append(s.buckets, nil)
+	copy(s.buckets[idx+1:], s.buckets[idx:])
+	s.buckets[idx] = bucket
+	return bucket
+}
+
+// expire drops buckets too old to be in any window
+func (s *LiveStats) expire(now int64) {
+	oldest := now - int64(s.retain/time.Second) - 1
+	drop := 0
+	for drop < len(s.buckets) && s.buckets[drop].second < oldest {
+		drop++
+	}
+	s.buckets = s.buckets[drop:]
+}
+
+// Window describes the results that completed within the given time
+// before now
+func (s *LiveStats) Window(d time.Duration) LiveWindow {
+	since := time.Now().Add(-d).Unix()
+	window := LiveWindow{Duration: d}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, bucket := range s.buckets {
+		if bucket.second < since {
+			continue
+		}
+		window.Requests += bucket.requests
+		window.Failures += bucket.failures
+		window.latencies = append(window.latencies, bucket.latencies...)
+	}
+	return window
+}
+
+// ConsecutiveConnErrors returns the number of results in a row, across all
+// sessions, that got no response at all
+func (s *LiveStats) ConsecutiveConnErrors() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.consecutive
+}
+
+// Totals returns a copy of the counts over the whole run
+func (s *LiveStats) Totals() LiveTotals {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	totals := s.totals
+	totals.StatusCodes = make(map[int]int)
+	for code, count := range s.totals.StatusCodes {
+		totals.StatusCodes[code] = count
+	}
+	totals.Errors = make(map[string]int)
+	for message, count := range s.totals.Errors {
+		totals.Errors[message] = count
+	}
+	totals.Paths = make(map[string]LivePath)
+	for key, path := range s.totals.Paths {
+		totals.Paths[key] = path
+	}
+	return totals
+}
+
+// PerSecond returns the number of results that completed in each of the
+// last n seconds (up to the time retained), oldest first
+func (s *LiveStats) PerSecond(n int) []int {
+	counts := make([]int, n)
+	first := time.Now().Unix() - int64(n) + 1
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, bucket := range s.buckets {
+		if idx := bucket.second - first; idx >= 0 && idx < int64(n) {
+			counts[idx] = bucket.requests
+		}
+	}
+	return counts
+}
+
+// ErrorRate is the fraction of results in the window that failed
+func (w LiveWindow) ErrorRate() float64 {
+	if w.Requests == 0 {
+		return 0
+	}
+	return float64(w.Failures) / float64(w.Requests)
+}
+
+// Percentile returns the latency that p percent (0-100) of the results in
+// the window were at or under
+func (w LiveWindow) Percentile(p float64) time.Duration {
+	if len(w.latencies) == 0 {
+		return 0
+	}
+	sort.Slice(w.latencies, func(i, j int) bool { return w.latencies[i] < w.latencies[j] })
+	idx := int(math.Ceil(p/100*float64(len(w.latencies)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return w.latencies[idx]
+}
+
+// isConnError returns true if the request got no response at all
+func isConnError(r *Result) bool {
+	return r.Code == 0 && r.Error != ""
+}
@@ -0,0 +1,29 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLiveStatsTotals(t *testing.T) {
+	stats := NewLiveStats(time.Minute)
+	now := time.Now().Truncate(time.Second) // so all three land in known seconds
+	stats.Observe("a", &Result{Timestamp: now.Add(-2 * time.Second), Method: "GET", Path: "/users/12", Code: 200, Latency: 10 * time.Millisecond})
+	stats.Observe("a", &Result{Timestamp: now, Method: "GET", Path: "/users/31?full=1", Code: 200, Latency: 30 * time.Millisecond})
+	stats.Observe("b", &Result{Timestamp: now, Method: "POST", Path: "/login", Code: 500, Error: "500 Internal Server Error"})
+
+	totals := stats.Totals()
+	if path := totals.Paths["GET /users/*"]; path.Requests != 2 || path.Mean() != 20*time.Millisecond || path.LatencyMax != 30*time.Millisecond {
+		t.Errorf("want 2 requests to GET /users/* with mean 20ms and max 30ms, got %+v", path)
+	}
+	if path := totals.Paths["POST /login"]; path.Requests != 1 || path.Failures != 1 {
+		t.Errorf("want 1 failed request to POST /login, got %+v", path)
+	}
+	if count := totals.Errors["500 Internal Server Error"]; count != 1 {
+		t.Errorf("want error counted once, got %d", count)
+	}
+
+	if perSecond := stats.PerSecond(3); time.Now().Unix() == now.Unix() && (perSecond[0] != 1 || perSecond[1] != 0 || perSecond[2] != 2) {
+		t.Errorf("want [1 0 2] requests in the last 3 seconds, got %v", perSecond)
+	}
+}
@@ -23,28 +23,67 @@ type Metrics struct {
 		Mean  float64 `json:"mean"`
 	} `json:"bytes_in"`
 
+	// BytesUncompressed are the response bodies once decompressed.
+	BytesUncompressed struct {
+		Total uint64  `json:"total"`
+		Mean  float64 `json:"mean"`
+	} `json:"bytes_uncompressed"`
+
 	BytesOut struct {
 		Total uint64  `json:"total"`
 		Mean  float64 `json:"mean"`
 	} `json:"bytes_out"`
 
+	// Throttle is the time requests waited for the rate limit, separate from
+	// their latency; Count is how many waited and Mean is over those.
+	Throttle struct {
+		Count uint64        `json:"count"`
+		Mean  time.Duration `json:"mean"`
+		Max   time.Duration `json:"max"`
+	} `json:"throttle"`
+
+	// Phases is the mean time requests spent in each phase, from looking up
+	// the host to reading the response; a phase that's skipped (say, by
+	// reusing a connection) counts as zero. Results recorded before phases
+	// were traced are left out.
+	Phases struct {
+		DNS       time.Duration `json:"dns"`
+		Connect   time.Duration `json:"connect"`
+		TLS       time.Duration `json:"tls"`
+		FirstByte time.Duration `json:"first_byte"`
+		Transfer  time.Duration `json:"transfer"`
+	} `json:"phases"`
+
+	// Connections counts the traced requests that opened a new connection
+	// and those that reused one.
+	Connections struct {
+		New    uint64 `json:"new"`
+		Reused uint64 `json:"reused"`
+	} `json:"connections"`
+
+	// Truncated is the number of responses with more body than was read.
+	Truncated uint64 `json:"truncated"`
+
 	// Duration is the duration of the attack.
 	Duration time.Duration `json:"duration"`
 	// Wait is the extra time waiting for responses from targets.
 	Wait time.Duration `json:"wait"`
 	// Requests is the total number of requests executed.
 	Requests uint64 `json:"requests"`
-	// Success is the percentage of non-error responses.
+	// Success is the percentage of responses without an error, including a
+	// failed assertion.
 	Success float64 `json:"success"`
 	// StatusCodes is a histogram of the responses' status codes.
 	StatusCodes map[string]int `json:"status_codes"`
 	// Errors is a set of unique errors returned by the targets during the attack.
 	Errors []string `json:"errors"`
+	// Assertions is a histogram of the assertions that failed.
+	Assertions map[string]int `json:"assertions"`
 }
 
 // NewMetrics computes and returns a Metrics struct out of a slice of Results.
 func NewMetrics(r Results) *Metrics {
-	m := &Metrics{StatusCodes: map[string]int{}}
+	m := &Metrics{StatusCodes: map[string]int{}, Assertions: map[string]int{}}
 
 	if len(r) == 0 {
 		return m
@@ -55,6 +94,9 @@ func NewMetrics(r Results) *Metrics {
 		quants         = quantile.NewTargeted(0.50, 0.95, 0.99)
 		totalSuccess   int
 		totalLatencies time.Duration
+		totalThrottle  time.Duration
+		totalPhases    [5]time.Duration
+		traced         uint64
 		latest         time.Time
 	)
 
@@ -64,15 +106,40 @@ func NewMetrics(r Results) *Metrics {
 		totalLatencies += result.Latency
 		m.BytesOut.Total += result.BytesOut
 		m.BytesIn.Total += result.BytesIn
+		m.BytesUncompressed.Total += result.BytesUncompressed
+		if result.Truncated {
+			m.Truncated++
+		}
 		if result.Latency > m.Latencies.Max {
 			m.Latencies.Max = result.Latency
 		}
 		if end := result.Timestamp.Add(result.Latency); end.After(latest) {
 			latest = end
 		}
-		if result.Code >= 200 && result.Code < 400 {
+		if result.Throttle > 0 {
+			m.Throttle.Count++
+			totalThrottle += result.Throttle
+			if result.Throttle > m.Throttle.Max {
+				m.Throttle.Max = result.Throttle
+			}
+		}
+		if result.traced() {
+			traced++
+			if result.Reused {
+				m.Connections.Reused++
+			} else {
+				m.Connections.New++
+			}
+			for idx, phase := range []time.Duration{result.DNS, result.Connect, result.TLS, result.FirstByte, result.Transfer} {
+				totalPhases[idx] += phase
+			}
+		}
+		if !result.Failed() {
 			totalSuccess++
 		}
+		if result.Assertion != "" {
+			m.Assertions[result.Assertion]++
+		}
 		if result.Error != "" {
 			errorSet[result.Error] = struct{}{}
 		}
@@ -85,7 +152,18 @@ func NewMetrics(r Results) *Metrics {
 	m.Latencies.P50 = time.Duration(quants.Query(0.50))
 	m.Latencies.P95 = time.Duration(quants.Query(0.95))
 	m.Latencies.P99 = time.Duration(quants.Query(0.99))
+	if m.Throttle.Count > 0 {
+		m.Throttle.Mean = totalThrottle / time.Duration(m.Throttle.Count)
+	}
+	if traced > 0 {
+		m.Phases.DNS = totalPhases[0] / time.Duration(traced)
+		m.Phases.Connect = totalPhases[1] / time.Duration(traced)
+		m.Phases.TLS = totalPhases[2] / time.Duration(traced)
+		m.Phases.FirstByte = totalPhases[3] / time.Duration(traced)
+		m.Phases.Transfer = totalPhases[4] / time.Duration(traced)
+	}
 	m.BytesIn.Mean = float64(m.BytesIn.Total) / float64(m.Requests)
+	m.BytesUncompressed.Mean = float64(m.BytesUncompressed.Total) / float64(m.Requests)
 	m.BytesOut.Mean = float64(m.BytesOut.Total) / float64(m.Requests)
 	m.Success = float64(totalSuccess) / float64(m.Requests)
 
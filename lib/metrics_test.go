@@ -9,10 +9,10 @@ func TestNewMetrics(t *testing.T) {
 	t.Parallel()
 
 	m := NewMetrics(Results{
-		&Result{500, time.Unix(0, 0), 100 * time.Millisecond, 10, 30, "Internal server error", "GET", "http://foo"},
-		&Result{200, time.Unix(1, 0), 20 * time.Millisecond, 20, 20, "", "GET", "http://foo"},
-		&Result{302, time.Unix(0, 0), 10 * time.Millisecond, 20, 20, "", "GET", "http://foo"},
-		&Result{200, time.Unix(2, 0), 30 * time.Millisecond, 30, 10, "", "GET", "http://foo"},
+		&Result{Code: 500, Timestamp: time.Unix(0, 0), Latency: 100 * time.Millisecond, BytesOut: 10, BytesIn: 30, Error: "Internal server error", Method: "GET", Path: "http://foo"},
+		&Result{Code: 200, Timestamp: time.Unix(1, 0), Latency: 20 * time.Millisecond, BytesOut: 20, BytesIn: 20, Method: "GET", Path: "http://foo"},
+		&Result{Code: 302, Timestamp: time.Unix(0, 0), Latency: 10 * time.Millisecond, BytesOut: 20, BytesIn: 20, Method: "GET", Path: "http://foo"},
+		&Result{Code: 200, Timestamp: time.Unix(2, 0), Latency: 30 * time.Millisecond, BytesOut: 30, BytesIn: 10, Method: "GET", Path: "http://foo"},
 	})
 
 	for field, values := range map[string][]float64{
@@ -0,0 +1,14 @@
+package korra
+
+// ResultObserver is told about every result as a session records it, so
+// results can be aggregated or forwarded while a run is going. Observers
+// are shared between sessions and must be safe to call concurrently.
+type ResultObserver interface {
+	Observe(session string, r *Result)
+}
+
+// ResultObserverFunc is an adapter to allow the use of ordinary functions as
+// ResultObservers.
+type ResultObserverFunc func(string, *Result)
+
+func (f ResultObserverFunc) Observe(session string, r *Result) { f(session, r) }
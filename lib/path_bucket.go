@@ -125,6 +125,19 @@ func pathToPieces(path string) []string {
 	return strings.Split(normalized, "/")
 }
 
+// bucketPath is the path with its query dropped and all-digit pieces
+// replaced by '*', the bucket NewPathBucketFromResult would infer, for
+// grouping results as they arrive
+func bucketPath(path string) string {
+	pieces := pathToPieces(path)
+	for idx, piece := range pieces {
+		if digitsPiece.MatchString(piece) {
+			pieces[idx] = "*"
+		}
+	}
+	return "/" + strings.Join(pieces, "/")
+}
+
 func (b *PathBucket) AddResult(result *Result) {
 	b.Results = append(b.Results, result)
 	// there's a race condition here when multiple goroutines are
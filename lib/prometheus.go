@@ -0,0 +1,129 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrometheusBuckets are the upper bounds, in seconds, of the latency
+// histogram buckets
+var PrometheusBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// PrometheusMetrics counts results from every session as they arrive and
+// writes them in the Prometheus text exposition format. Results are grouped
+// by method and path bucket -- the path without its query and with any
+// all-digit pieces replaced by '*', just as the text report infers its
+// buckets -- so '/users/12' and '/users/31' are counted together. It's a
+// ResultObserver.
+type PrometheusMetrics struct {
+	lock   sync.Mutex
+	series map[promKey]*promSeries
+}
+
+type promKey struct {
+	method string
+	bucket string
+}
+
+type promSeries struct {
+	statuses map[uint16]uint64
+	polls    uint64
+	counts   []uint64 // results at or under each of PrometheusBuckets
+	count    uint64
+	sum      time.Duration
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{series: make(map[promKey]*promSeries)}
+}
+
+// Observe counts the result under its method and path bucket
+func (p *PrometheusMetrics) Observe(session string, r *Result) {
+	key := promKey{r.Method, bucketPath(r.Path)}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	series, ok := p.series[key]
+	if !ok {
+		series = &promSeries{statuses: make(map[uint16]uint64), counts: make([]uint64, len(PrometheusBuckets))}
+		p.series[key] = series
+	}
+	series.statuses[r.Code]++
+	if r.RequestCount > 1 {
+		series.polls++
+	}
+	seconds := r.Latency.Seconds()
+	for idx, bound := range PrometheusBuckets {
+		if seconds <= bound {
+			series.counts[idx]++
+		}
+	}
+	series.count++
+	series.sum += r.Latency
+}
+
+// Write writes every metric in the text exposition format
+func (p *PrometheusMetrics) Write(w io.Writer) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	keys := make([]promKey, 0, len(p.series))
+	for key := range p.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].bucket < keys[j].bucket
+	})
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "# HELP korra_requests_total Requests made, by method, path bucket and status code (0 for no response).")
+	fmt.Fprintln(out, "# TYPE korra_requests_total counter")
+	for _, key := range keys {
+		statuses := p.series[key].statuses
+		codes := make([]int, 0, len(statuses))
+		for code := range statuses {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(out, "korra_requests_total{%s,status=\"%d\"} %d\n", key.labels(), code, statuses[uint16(code)])
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP korra_request_duration_seconds Latency of requests, by method and path bucket.")
+	fmt.Fprintln(out, "# TYPE korra_request_duration_seconds histogram")
+	for _, key := range keys {
+		series := p.series[key]
+		for idx, bound := range PrometheusBuckets {
+			fmt.Fprintf(out, "korra_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				key.labels(), strconv.FormatFloat(bound, 'g', -1, 64), series.counts[idx])
+		}
+		fmt.Fprintf(out, "korra_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key.labels(), series.count)
+		fmt.Fprintf(out, "korra_request_duration_seconds_sum{%s} %s\n", key.labels(), strconv.FormatFloat(series.sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(out, "korra_request_duration_seconds_count{%s} %d\n", key.labels(), series.count)
+	}
+
+	fmt.Fprintln(out, "# HELP korra_poll_retries_total Requests repeated while polling, by method and path bucket.")
+	fmt.Fprintln(out, "# TYPE korra_poll_retries_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(out, "korra_poll_retries_total{%s} %d\n", key.labels(), p.series[key].polls)
+	}
+	return out.Flush()
+}
+
+func (key promKey) labels() string {
+	return fmt.Sprintf("method=\"%s\",bucket=\"%s\"", promEscape(key.method), promEscape(key.bucket))
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promEscape(value string) string {
+	return promEscaper.Replace(value)
+}
@@ -0,0 +1,36 @@
+package korra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	metrics.Observe("a", &Result{Method: "GET", Path: "/users/12?full=1", Code: 200, Latency: 20 * time.Millisecond, RequestCount: 1})
+	metrics.Observe("b", &Result{Method: "GET", Path: "/users/31", Code: 200, Latency: 300 * time.Millisecond, RequestCount: 2})
+	metrics.Observe("b", &Result{Method: "POST", Path: "/login", Code: 0, Latency: 2 * time.Second, RequestCount: 1})
+
+	var out bytes.Buffer
+	if err := metrics.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE korra_requests_total counter\n",
+		`korra_requests_total{method="GET",bucket="/users/*",status="200"} 2` + "\n",
+		`korra_requests_total{method="POST",bucket="/login",status="0"} 1` + "\n",
+		`korra_request_duration_seconds_bucket{method="GET",bucket="/users/*",le="0.025"} 1` + "\n",
+		`korra_request_duration_seconds_bucket{method="GET",bucket="/users/*",le="0.5"} 2` + "\n",
+		`korra_request_duration_seconds_bucket{method="POST",bucket="/login",le="1"} 0` + "\n",
+		`korra_request_duration_seconds_bucket{method="POST",bucket="/login",le="+Inf"} 1` + "\n",
+		`korra_request_duration_seconds_sum{method="GET",bucket="/users/*"} 0.32` + "\n",
+		`korra_request_duration_seconds_count{method="GET",bucket="/users/*"} 2` + "\n",
+		`korra_poll_retries_total{method="GET",bucket="/users/*"} 1` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("want metrics to include %q, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package korra
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ramp schedules when each session starts, so a run can build up to its
+// full load rather than opening every connection at once. It's one of:
+//
+//    5m                        start sessions evenly over 5 minutes
+//    100/30s                   start 100 sessions every 30 seconds
+//    0s:100, 2m:1000, 10m:5000 stages: the number of sessions started by
+//                              each time, spread evenly between stages
+//
+// Stages can also be read from a file, one or more to a line; any sessions
+// beyond the last stage start at its time.
+type Ramp struct {
+	Spec   string
+	batch  int
+	every  time.Duration
+	stages []rampStage
+}
+
+type rampStage struct {
+	at    time.Duration
+	count int
+}
+
+var rampStep = regexp.MustCompile(`^(\d+)\s*/\s*(\S+)$`)
+
+func NewRamp(spec string) (*Ramp, error) {
+	spec = strings.TrimSpace(spec)
+	ramp := &Ramp{Spec: spec}
+	if duration, err := time.ParseDuration(spec); err == nil {
+		ramp.every = duration
+		return ramp, nil
+	}
+	if matches := rampStep.FindStringSubmatch(spec); matches != nil {
+		ramp.batch, _ = strconv.Atoi(matches[1])
+		every, err := time.ParseDuration(matches[2])
+		if err != nil || ramp.batch == 0 || every <= 0 {
+			return nil, fmt.Errorf("Expected ramp steps as COUNT/DURATION (e.g. 100/30s), got '%s'", spec)
+		}
+		ramp.every = every
+		return ramp, nil
+	}
+	stages := spec
+	if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+		content, err := ioutil.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ramp file %s: %s", spec, err)
+		}
+		stages = string(content)
+	}
+	if err := ramp.parseStages(stages); err != nil {
+		return nil, err
+	}
+	return ramp, nil
+}
+
+func (ramp *Ramp) parseStages(spec string) error {
+	previous := rampStage{}
+	for _, stageSpec := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if stageSpec = strings.TrimSpace(stageSpec); stageSpec == "" || strings.HasPrefix(stageSpec, "#") {
+			continue
+		}
+		tokens := strings.SplitN(stageSpec, ":", 2)
+		if len(tokens) != 2 {
+			return fmt.Errorf("Expected ramp as a duration, COUNT/DURATION or stages of DURATION:COUNT, got '%s'", stageSpec)
+		}
+		at, err := time.ParseDuration(strings.TrimSpace(tokens[0]))
+		if err != nil {
+			return fmt.Errorf("Bad time for ramp stage '%s': %s", stageSpec, err)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(tokens[1]))
+		if err != nil {
+			return fmt.Errorf("Expected int count for ramp stage '%s'", stageSpec)
+		}
+		stage := rampStage{at, count}
+		if stage.at < previous.at || stage.count < previous.count {
+			return fmt.Errorf("Ramp stages must increase in time and count, got '%s' after '%s'", stageSpec, previous)
+		}
+		ramp.stages = append(ramp.stages, stage)
+		previous = stage
+	}
+	if len(ramp.stages) == 0 {
+		return fmt.Errorf("Expected at least one ramp stage, got '%s'", spec)
+	}
+	return nil
+}
+
+// Offset returns how long after the start of the run the session at index
+// idx (from 0) of total should start
+func (ramp *Ramp) Offset(idx, total int) time.Duration {
+	if ramp == nil {
+		return 0
+	} else if ramp.batch > 0 {
+		return time.Duration(idx/ramp.batch) * ramp.every
+	} else if ramp.stages == nil {
+		return time.Duration(int64(ramp.every) * int64(idx) / int64(total))
+	}
+	previous := rampStage{}
+	for _, stage := range ramp.stages {
+		if idx < stage.count {
+			fraction := float64(idx-previous.count) / float64(stage.count-previous.count)
+			return previous.at + time.Duration(fraction*float64(stage.at-previous.at))
+		}
+		previous = stage
+	}
+	return previous.at
+}
+
+func (stage rampStage) String() string {
+	return fmt.Sprintf("%s:%d", stage.at, stage.count)
+}
+
+func (ramp *Ramp) String() string {
+	return ramp.Spec
+}
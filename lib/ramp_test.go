@@ -0,0 +1,37 @@
+package korra
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRampOffsets(t *testing.T) {
+	for spec, want := range map[string][]time.Duration{
+		"10s":                    {0, 2 * time.Second, 4 * time.Second, 6 * time.Second, 8 * time.Second},
+		"2/30s":                  {0, 0, 30 * time.Second, 30 * time.Second, time.Minute},
+		"0s:2, 1m:4":             {0, 0, 0, 30 * time.Second, time.Minute},
+		"10s:1\n20s:3\n# rest\n": {0, 10 * time.Second, 15 * time.Second, 20 * time.Second, 20 * time.Second},
+	} {
+		ramp, err := NewRamp(spec)
+		if err != nil {
+			t.Fatalf("%q: %s", spec, err)
+		}
+		for idx, offset := range want {
+			if got := ramp.Offset(idx, len(want)); got != offset {
+				t.Errorf("%q session %d: want %s, got %s", spec, idx, offset, got)
+			}
+		}
+	}
+	var none *Ramp
+	if got := none.Offset(3, 5); got != 0 {
+		t.Errorf("want no offset without a ramp, got %s", got)
+	}
+}
+
+func TestRampErrors(t *testing.T) {
+	for _, spec := range []string{"soon", "0/30s", "5/never", "1m:100, 30s:200", "1m:100, 2m:50", "1m:lots"} {
+		if _, err := NewRamp(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
@@ -123,7 +123,21 @@ func resultsToText(out io.Writer, showUrls bool, r Results, urlCounts map[string
 	fmt.Fprintf(w, "Duration\t[total, attack, wait]\t%s, %s, %s\n", m.Duration+m.Wait, m.Duration, m.Wait)
 	fmt.Fprintf(w, "Latencies\t[mean, 50, 95, 99, max]\t%s, %s, %s, %s, %s\n",
 		m.Latencies.Mean, m.Latencies.P50, m.Latencies.P95, m.Latencies.P99, m.Latencies.Max)
+	if m.Throttle.Count > 0 {
+		fmt.Fprintf(w, "Throttled\t[count, mean, max]\t%d, %s, %s\n", m.Throttle.Count, m.Throttle.Mean, m.Throttle.Max)
+	}
+	if m.Connections.New+m.Connections.Reused > 0 {
+		fmt.Fprintf(w, "Phases\t[dns, connect, tls, first byte, transfer]\t%s, %s, %s, %s, %s\n",
+			m.Phases.DNS, m.Phases.Connect, m.Phases.TLS, m.Phases.FirstByte, m.Phases.Transfer)
+		fmt.Fprintf(w, "Connections\t[new, reused]\t%d, %d\n", m.Connections.New, m.Connections.Reused)
+	}
 	fmt.Fprintf(w, "Bytes In\t[total, mean]\t%d, %.2f\n", m.BytesIn.Total, m.BytesIn.Mean)
+	if m.BytesUncompressed.Total > m.BytesIn.Total {
+		fmt.Fprintf(w, "Uncompressed\t[total, mean]\t%d, %.2f\n", m.BytesUncompressed.Total, m.BytesUncompressed.Mean)
+	}
+	if m.Truncated > 0 {
+		fmt.Fprintf(w, "Truncated\t[count]\t%d\n", m.Truncated)
+	}
 	fmt.Fprintf(w, "Bytes Out\t[total, mean]\t%d, %.2f\n", m.BytesOut.Total, m.BytesOut.Mean)
 	fmt.Fprintf(w, "Success\t[ratio]\t%.2f%%\n", m.Success*100)
 	fmt.Fprintf(w, "Status Codes\t[code:count]\t")
@@ -134,6 +148,12 @@ func resultsToText(out io.Writer, showUrls bool, r Results, urlCounts map[string
 	if errorCount == "0" {
 		errorCount = "(empty)"
 	}
+	if len(m.Assertions) > 0 {
+		fmt.Fprintf(w, "\nAssertion Failures\t[assertion:count]\t")
+		for _, assertion := range sortedKeys(m.Assertions) {
+			fmt.Fprintf(w, "%s:%d  ", assertion, m.Assertions[assertion])
+		}
+	}
 	fmt.Fprintf(w, "\nError Set: %s\n", errorCount)
 	for _, err := range m.Errors {
 		fmt.Fprintln(w, err)
@@ -154,6 +174,15 @@ func resultsToText(out io.Writer, showUrls bool, r Results, urlCounts map[string
 	return w.Flush()
 }
 
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ReportJSON writes a computed Metrics struct to as JSON
 var ReportJSON ReporterFunc = func(r Results) ([]byte, error) {
 	return json.Marshal(NewMetrics(r))
@@ -15,21 +15,51 @@ func init() {
 // Result represents the metrics defined out of an http.Response
 // generated by each target hit
 type Result struct {
-	BytesOut     uint64        `json:"bytes_out"`
-	BytesIn      uint64        `json:"bytes_in"`
-	Code         uint16        `json:"code"`
-	Error        string        `json:"error"`
-	Latency      time.Duration `json:"latency"`
-	Method       string        `json:"method"`
-	RequestCount int           `json:"request_count"`
-	Timestamp    time.Time     `json:"timestamp"`
-	Path         string        `json:"path"`
+	Assertion         string        `json:"assertion"`
+	Branch            string        `json:"branch"`
+	BytesOut          uint64        `json:"bytes_out"`
+	BytesIn           uint64        `json:"bytes_in"`
+	BytesUncompressed uint64        `json:"bytes_uncompressed"` // body size once decompressed
+	Code              uint16        `json:"code"`
+	Connect           time.Duration `json:"connect"`
+	DNS               time.Duration `json:"dns"`
+	Error             string        `json:"error"`
+	FirstByte         time.Duration `json:"first_byte"`
+	Iteration         int           `json:"iteration"`
+	Latency           time.Duration `json:"latency"`
+	Line              string        `json:"line"` // position of the action in the script, like "12" or "login.txt:3"
+	Method            string        `json:"method"`
+	Repeat            int           `json:"repeat"`
+	RequestCount      int           `json:"request_count"` // attempt number when polling
+	Reused            bool          `json:"reused"`
+	Session           string        `json:"session"`
+	Step              string        `json:"step"` // name from the last STEP in the script
+	Throttle          time.Duration `json:"throttle"`
+	Timestamp         time.Time     `json:"timestamp"`
+	TLS               time.Duration `json:"tls"`
+	Transfer          time.Duration `json:"transfer"`
+	Truncated         bool          `json:"truncated"` // body was longer than the cap on reading it
+	Path              string        `json:"path"`
+	capture           *Capture      // the request and response, if capturing
 }
 
 func (result *Result) HasErrorCode() bool {
 	return result.Code < 200 || result.Code >= 400
 }
 
+// Failed returns true if the transaction had any error -- a bad status
+// code, a failed assertion or extraction, or no response at all
+func (result *Result) Failed() bool {
+	return result.Error != ""
+}
+
+// traced returns true if the phases of the request were recorded, which
+// they aren't for results from older versions, or requests that never got
+// a connection
+func (result *Result) traced() bool {
+	return result.Reused || result.Connect > 0 || result.FirstByte > 0
+}
+
 var pathFromUrl = regexp.MustCompile("^\\w+://[^/]+(.*)$")
 
 func (result *Result) PathFromURL(url string) {
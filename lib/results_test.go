@@ -0,0 +1,45 @@
+package korra
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+)
+
+// resultV1 is a Result as older versions wrote it, before results knew
+// which session and script line they came from
+type resultV1 struct {
+	Code      uint16
+	Timestamp time.Time
+	Latency   time.Duration
+	Method    string
+	Path      string
+	Error     string
+}
+
+func TestResultGobCompatible(t *testing.T) {
+	timestamp := time.Now().Round(time.Millisecond)
+	var buf bytes.Buffer
+	old := resultV1{Code: 200, Timestamp: timestamp, Latency: time.Second, Method: "GET", Path: "/foo"}
+	if err := gob.NewEncoder(&buf).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	var result Result
+	if err := gob.NewDecoder(&buf).Decode(&result); err != nil {
+		t.Fatalf("want old result read, got %s", err)
+	}
+	if result.Code != 200 || !result.Timestamp.Equal(timestamp) || result.Path != "/foo" || result.Session != "" || result.Line != "" {
+		t.Errorf("bad result from old version: %+v", result)
+	}
+
+	// and older versions can read new results
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(&Result{Code: 500, Method: "POST", Path: "/bar", Session: "api", Line: "3", Step: "checkout"}); err != nil {
+		t.Fatal(err)
+	}
+	old = resultV1{}
+	if err := gob.NewDecoder(&buf).Decode(&old); err != nil || old.Code != 500 || old.Path != "/bar" {
+		t.Errorf("want new result read as old, got %+v (%v)", old, err)
+	}
+}
@@ -0,0 +1,601 @@
+package korra
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScriptControl is a command that changes which action a session runs
+// next rather than doing anything itself. A block runs the actions between
+// its opening command and the matching END:
+//
+//    REPEAT 50
+//    GET http://api.com/feed
+//    PAUSE 2000
+//    END
+//
+// and 'REPEAT for 5m' repeats the block until five minutes have passed,
+// checking at the end of each iteration. An IF block runs its actions only
+// if its condition holds, otherwise those after the optional ELSE:
+//
+//    IF status=404
+//    POST http://api.com/cart
+//    ELSE
+//    GET http://api.com/cart/items
+//    END
+//
+// A CHOOSE block runs just one of its OPTIONs, picked at random according
+// to their weights, and the optional name after the weight identifies the
+// branch in results:
+//
+//    CHOOSE
+//    OPTION 70 browse
+//    GET http://api.com/catalog
+//    OPTION 30 search
+//    GET http://api.com/search?q=korra
+//    END
+//
+// GOTO continues the session from the named LABEL. Finally, STEP names the
+// actions that follow it, up to the next STEP, so their results can be
+// grouped in reports; a STEP without a name clears it:
+//
+//    STEP checkout
+//    POST http://api.com/cart/checkout
+//    GET http://api.com/orders/${order}
+type ScriptControl struct {
+	Command   string
+	Count     int
+	Duration  time.Duration
+	Condition *Condition
+	Label     string // name of a LABEL, GOTO target, OPTION or STEP
+	Weight    int
+	match     int   // index of the action at the other end of the block, or the GOTO label
+	alt       int   // index of the ELSE in an IF block, 0 if none
+	options   []int // indexes of the OPTIONs in a CHOOSE block
+}
+
+var (
+	repeatCommand = regexp.MustCompile("^REPEAT(\\s|$)")
+	ifCommand     = regexp.MustCompile("^IF(\\s|$)")
+	elseCommand   = regexp.MustCompile("^ELSE$")
+	endCommand    = regexp.MustCompile("^END$")
+	labelCommand  = regexp.MustCompile("^LABEL(\\s|$)")
+	gotoCommand   = regexp.MustCompile("^GOTO(\\s|$)")
+	chooseCommand = regexp.MustCompile("^CHOOSE$")
+	optionCommand = regexp.MustCompile("^OPTION(\\s|$)")
+	stepCommand   = regexp.MustCompile("^STEP(\\s|$)")
+)
+
+// maxControlSteps limits how many control actions a script runs in a row
+// without running anything else, so a GOTO loop with no other actions in it
+// ends the script rather than spinning forever
+const maxControlSteps = 100000
+
+func isControlCommand(line string) bool {
+	return repeatCommand.MatchString(line) || ifCommand.MatchString(line) ||
+		elseCommand.MatchString(line) || endCommand.MatchString(line) ||
+		labelCommand.MatchString(line) || gotoCommand.MatchString(line) ||
+		chooseCommand.MatchString(line) || optionCommand.MatchString(line) ||
+		stepCommand.MatchString(line)
+}
+
+// controlKeyword returns the command of a raw control action, even one
+// whose arguments are invalid, so blocks can be matched up regardless
+func controlKeyword(action *SessionAction) string {
+	if !isControlCommand(action.Raw) {
+		return ""
+	}
+	return strings.Fields(action.Raw)[0]
+}
+
+func newScriptControl(line string) (*ScriptControl, error) {
+	tokens := strings.Fields(line)
+	control := &ScriptControl{Command: tokens[0]}
+	switch control.Command {
+	case "REPEAT":
+		if len(tokens) == 3 && tokens[1] == "for" {
+			duration, err := time.ParseDuration(tokens[2])
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("Expected duration like '5m' for REPEAT, got '%s'", tokens[2])
+			}
+			control.Duration = duration
+		} else if len(tokens) == 2 {
+			count, err := strconv.Atoi(tokens[1])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("Expected non-negative int as argument to REPEAT, got '%s'", tokens[1])
+			}
+			control.Count = count
+		} else {
+			return nil, fmt.Errorf("Expected 'REPEAT count' or 'REPEAT for duration', got '%s'", line)
+		}
+	case "IF":
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("Expected condition as argument to IF")
+		}
+		condition, err := NewCondition(strings.TrimSpace(line[2:]))
+		if err != nil {
+			return nil, err
+		}
+		control.Condition = condition
+	case "LABEL", "GOTO":
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("Expected a single label name as argument to %s, got '%s'", control.Command, line)
+		}
+		control.Label = tokens[1]
+	case "OPTION":
+		if len(tokens) < 2 || len(tokens) > 3 {
+			return nil, fmt.Errorf("Expected weight and optional name as arguments to OPTION, got '%s'", line)
+		}
+		weight, err := strconv.Atoi(tokens[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("Expected non-negative int weight for OPTION, got '%s'", tokens[1])
+		}
+		control.Weight = weight
+		if len(tokens) == 3 {
+			control.Label = tokens[2]
+		}
+	case "STEP":
+		if len(tokens) > 2 {
+			return nil, fmt.Errorf("Expected a single step name as argument to STEP, got '%s'", line)
+		} else if len(tokens) == 2 {
+			control.Label = tokens[1]
+		}
+	}
+	return control, nil
+}
+
+func (control *ScriptControl) String() string {
+	switch control.Command {
+	case "REPEAT":
+		if control.Duration > 0 {
+			return fmt.Sprintf("REPEAT for %s", control.Duration)
+		}
+		return fmt.Sprintf("REPEAT %d", control.Count)
+	case "IF":
+		return fmt.Sprintf("IF %s", control.Condition)
+	case "LABEL", "GOTO":
+		return fmt.Sprintf("%s %s", control.Command, control.Label)
+	case "OPTION":
+		return strings.TrimSpace(fmt.Sprintf("OPTION %d %s", control.Weight, control.Label))
+	case "STEP":
+		return strings.TrimSpace("STEP " + control.Label)
+	}
+	return control.Command
+}
+
+// Condition is the test in an IF, checked against the last response the
+// session got or one of its variables:
+//
+//    status=404      status!=200      status~^5
+//    name=value      name!=value      name~regex
+//
+// where '~' matches a regular expression. A value compared with '=' or
+// '!=' may reference other variables as ${name}.
+type Condition struct {
+	Subject string
+	Op      string
+	Value   string
+	pattern *regexp.Regexp
+}
+
+var conditionSpec = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.\-]*)\s*(!=|=|~)\s*(.*)$`)
+
+func NewCondition(spec string) (*Condition, error) {
+	matches := conditionSpec.FindStringSubmatch(spec)
+	if matches == nil {
+		return nil, fmt.Errorf("Expected condition like 'status=404' or 'name~regex', got '%s'", spec)
+	}
+	condition := &Condition{Subject: matches[1], Op: matches[2], Value: matches[3]}
+	if condition.Op == "~" {
+		var err error
+		if condition.pattern, err = regexp.Compile(condition.Value); err != nil {
+			return nil, fmt.Errorf("Bad regex '%s': %s", condition.Value, err)
+		}
+	}
+	return condition, nil
+}
+
+// Holds checks the condition against the last result (which may be nil if
+// there isn't one yet) and variables
+func (c *Condition) Holds(last *Result, vars *Variables) bool {
+	var actual string
+	if c.Subject == "status" {
+		if last != nil {
+			actual = strconv.Itoa(int(last.Code))
+		} else {
+			actual = "0"
+		}
+	} else {
+		actual, _ = vars.Get(c.Subject)
+	}
+	if c.pattern != nil {
+		return c.pattern.MatchString(actual)
+	}
+	expected, err := vars.Expand(c.Value)
+	if err != nil {
+		expected = c.Value
+	}
+	return (actual == expected) == (c.Op == "=")
+}
+
+// References returns the names of the variables the condition checks or
+// compares against
+func (c *Condition) References() []string {
+	var refs []string
+	if c.Subject != "status" {
+		refs = append(refs, c.Subject)
+	}
+	if c.pattern == nil {
+		refs = append(refs, References(c.Value)...)
+	}
+	return refs
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s%s%s", c.Subject, c.Op, c.Value)
+}
+
+// scriptFrame tracks a REPEAT or CHOOSE block the script is currently
+// running
+type scriptFrame struct {
+	start     int
+	end       int
+	iteration int
+	deadline  time.Time
+	branch    string
+}
+
+// link matches up the beginning and end of every block and every GOTO with
+// its LABEL, marking the actions of unbalanced blocks and unreachable labels
+// as invalid, and returns the first problem found.
+func (script *SessionScript) link() error {
+	var (
+		first     error
+		open      []int
+		elseOf    = make(map[int]int)
+		labels    = make(map[string]int)
+		enclosing = make([][]int, len(script.Actions))
+	)
+	mark := func(action *SessionAction, message string) {
+		if action.Error != nil {
+			return
+		}
+		if err := action.BadLine(0, message); first == nil {
+			first = err
+		}
+	}
+	for idx, action := range script.Actions {
+		// remember the REPEAT and CHOOSE blocks each action is in, to check GOTOs
+		for _, opener := range open {
+			if keyword := controlKeyword(script.Actions[opener]); keyword == "REPEAT" || keyword == "CHOOSE" {
+				enclosing[idx] = append(enclosing[idx], opener)
+			}
+		}
+		switch keyword := controlKeyword(action); keyword {
+		case "REPEAT", "IF", "CHOOSE":
+			open = append(open, idx)
+		case "OPTION":
+			if len(open) == 0 || controlKeyword(script.Actions[open[len(open)-1]]) != "CHOOSE" {
+				mark(action, "OPTION without a matching CHOOSE")
+			} else if target := script.Actions[open[len(open)-1]].Target; target != nil && target.Control != nil {
+				target.Control.options = append(target.Control.options, idx)
+			}
+		case "ELSE":
+			if len(open) == 0 || controlKeyword(script.Actions[open[len(open)-1]]) != "IF" {
+				mark(action, "ELSE without a matching IF")
+			} else if prior, ok := elseOf[open[len(open)-1]]; ok {
+				mark(action, fmt.Sprintf("IF already has an ELSE on %s", script.Actions[prior].location(0)))
+			} else {
+				elseOf[open[len(open)-1]] = idx
+			}
+		case "END":
+			if len(open) == 0 {
+				mark(action, "END without a matching REPEAT, IF or CHOOSE")
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			script.setMatch(start, idx)
+			script.setMatch(idx, start)
+			if alt, ok := elseOf[start]; ok {
+				script.setMatch(alt, idx)
+				if target := script.Actions[start].Target; target != nil && target.Control != nil {
+					target.Control.alt = alt
+				}
+			}
+			if controlKeyword(script.Actions[start]) == "CHOOSE" {
+				script.linkOptions(start, idx, mark)
+			}
+		case "LABEL":
+			if fields := strings.Fields(action.Raw); len(fields) == 2 {
+				if prior, ok := labels[fields[1]]; ok {
+					mark(action, fmt.Sprintf("Label '%s' already defined on %s", fields[1], script.Actions[prior].location(0)))
+				} else {
+					labels[fields[1]] = idx
+				}
+			}
+		}
+	}
+	for _, idx := range open {
+		mark(script.Actions[idx], fmt.Sprintf("%s without a matching END", controlKeyword(script.Actions[idx])))
+	}
+	for idx, action := range script.Actions {
+		target := action.Target
+		if target == nil || !target.IsControl() || target.Control.Command != "GOTO" {
+			continue
+		}
+		labelIdx, ok := labels[target.Control.Label]
+		if !ok {
+			mark(action, fmt.Sprintf("GOTO undefined label '%s'", target.Control.Label))
+		} else if !isPrefix(enclosing[labelIdx], enclosing[idx]) {
+			mark(action, fmt.Sprintf("Label '%s' on %s is inside a REPEAT or CHOOSE block and can't be reached from outside it",
+				target.Control.Label, script.Actions[labelIdx].location(0)))
+		} else {
+			target.Control.match = labelIdx
+		}
+	}
+	script.expected = script.expectedRuns(0, len(script.Actions))
+	return first
+}
+
+// linkOptions checks the CHOOSE block between the two positions starts with
+// an OPTION and can choose one, and points every OPTION at the END
+func (script *SessionScript) linkOptions(start, end int, mark func(*SessionAction, string)) {
+	if controlKeyword(script.Actions[start+1]) != "OPTION" {
+		mark(script.Actions[start], "Expected OPTION on the line after CHOOSE")
+	}
+	target := script.Actions[start].Target
+	if target == nil || target.Control == nil {
+		return
+	}
+	total := 0
+	for _, option := range target.Control.options {
+		script.setMatch(option, end)
+		if optionTarget := script.Actions[option].Target; optionTarget != nil && optionTarget.Control != nil {
+			total += optionTarget.Control.Weight
+		}
+	}
+	if total == 0 {
+		mark(script.Actions[start], "CHOOSE needs at least one OPTION with a weight above 0")
+	}
+}
+
+func (script *SessionScript) setMatch(idx, match int) {
+	if target := script.Actions[idx].Target; target != nil && target.Control != nil {
+		target.Control.match = match
+	}
+}
+
+func isPrefix(prefix, of []int) bool {
+	if len(prefix) > len(of) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != of[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// expectedRuns estimates how many actions a session runs between the two
+// positions, counting every iteration of a REPEAT with a count, a single
+// iteration of a REPEAT with a duration, and the longest branch of an IF or
+// CHOOSE. GOTOs are ignored.
+func (script *SessionScript) expectedRuns(from, to int) int {
+	runs := 0
+	for idx := from; idx < to; idx++ {
+		target := script.Actions[idx].Target
+		if target == nil || !target.IsControl() {
+			runs += 1
+			continue
+		}
+		control := target.Control
+		if control.match <= idx {
+			continue
+		}
+		switch control.Command {
+		case "REPEAT":
+			iterations := control.Count
+			if control.Duration > 0 {
+				iterations = 1
+			}
+			runs += iterations * script.expectedRuns(idx+1, control.match)
+			idx = control.match
+		case "IF":
+			if control.alt > 0 {
+				runs += maxInt(script.expectedRuns(idx+1, control.alt), script.expectedRuns(control.alt+1, control.match))
+			} else {
+				runs += script.expectedRuns(idx+1, control.match)
+			}
+			idx = control.match
+		case "CHOOSE":
+			longest := 0
+			for i, option := range control.options {
+				next := control.match
+				if i+1 < len(control.options) {
+					next = control.options[i+1]
+				}
+				longest = maxInt(longest, script.expectedRuns(option+1, next))
+			}
+			runs += longest
+			idx = control.match
+		}
+	}
+	return runs
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// advance runs any control actions at the current position, leaving it at
+// the next action for the session to run (or the end of the script)
+func (script *SessionScript) advance() {
+	for steps := 0; script.Current < len(script.Actions); steps++ {
+		target := script.Actions[script.Current].Target
+		if target == nil || !target.IsControl() {
+			return
+		}
+		if steps == maxControlSteps {
+			script.Current = len(script.Actions)
+			return
+		}
+		script.Current = script.control(script.Current, target.Control)
+	}
+}
+
+// control runs the control action at the given position and returns the
+// position to run next
+func (script *SessionScript) control(idx int, control *ScriptControl) int {
+	switch control.Command {
+	case "REPEAT":
+		if control.Count == 0 && control.Duration == 0 {
+			return control.match + 1
+		}
+		frame := &scriptFrame{start: idx, end: control.match, iteration: 1}
+		if control.Duration > 0 {
+			frame.deadline = time.Now().Add(control.Duration)
+		}
+		script.frames = append(script.frames, frame)
+	case "IF":
+		if control.Condition.Holds(script.last, script.Actions[idx].Scope(script.Vars)) {
+			return idx + 1
+		} else if control.alt > 0 {
+			return control.alt + 1
+		}
+		return control.match + 1
+	case "ELSE":
+		// only reached at the end of the IF branch
+		return control.match + 1
+	case "CHOOSE":
+		option := script.choose(control)
+		optionControl := script.Actions[option].Target.Control
+		branch := optionControl.Label
+		if branch == "" {
+			branch = "line " + script.Actions[option].Position()
+		}
+		script.frames = append(script.frames, &scriptFrame{start: idx, end: control.match, branch: branch})
+		script.chosen = append(script.chosen, branch)
+		return option + 1
+	case "OPTION":
+		// only reached at the end of the chosen option, so finish the block
+		return control.match
+	case "STEP":
+		script.step = control.Label
+	case "GOTO":
+		for frame := script.frame(); frame != nil && (control.match < frame.start || control.match > frame.end); frame = script.frame() {
+			script.frames = script.frames[:len(script.frames)-1]
+		}
+		return control.match + 1
+	case "END":
+		frame := script.frame()
+		if frame == nil || frame.end != idx {
+			return idx + 1
+		}
+		opener := script.Actions[frame.start].Target.Control
+		if opener.Command == "REPEAT" && ((opener.Duration > 0 && time.Now().Before(frame.deadline)) ||
+			(opener.Duration == 0 && frame.iteration < opener.Count)) {
+			frame.iteration += 1
+			return frame.start + 1
+		}
+		script.frames = script.frames[:len(script.frames)-1]
+	}
+	return idx + 1
+}
+
+// choose picks one of the OPTIONs in a CHOOSE block according to their
+// weights and returns its position
+func (script *SessionScript) choose(control *ScriptControl) int {
+	total := 0
+	for _, option := range control.options {
+		total += script.Actions[option].Target.Control.Weight
+	}
+	var pick int
+	if script.Random != nil {
+		pick = script.Random.Intn(total)
+	} else {
+		pick = rand.Intn(total)
+	}
+	for _, option := range control.options {
+		if pick -= script.Actions[option].Target.Control.Weight; pick < 0 {
+			return option
+		}
+	}
+	return control.options[len(control.options)-1]
+}
+
+// frame returns the innermost block the script is running, if any
+func (script *SessionScript) frame() *scriptFrame {
+	if len(script.frames) == 0 {
+		return nil
+	}
+	return script.frames[len(script.frames)-1]
+}
+
+// Record keeps the result the session just got so the next IF can check it
+func (script *SessionScript) Record(result *Result) {
+	script.last = result
+}
+
+// Repeat returns the iteration of the innermost REPEAT block the script is
+// running, starting at 1, or 0 if it's not in one
+func (script *SessionScript) Repeat() int {
+	for idx := len(script.frames) - 1; idx >= 0; idx-- {
+		if frame := script.frames[idx]; frame.branch == "" {
+			return frame.iteration
+		}
+	}
+	return 0
+}
+
+// Branch returns the names of the options chosen by every CHOOSE block the
+// script is running, outermost first and separated by '/'
+func (script *SessionScript) Branch() string {
+	var branches []string
+	for _, frame := range script.frames {
+		if frame.branch != "" {
+			branches = append(branches, frame.branch)
+		}
+	}
+	return strings.Join(branches, "/")
+}
+
+// Step returns the name given by the last STEP the script ran, if any
+func (script *SessionScript) Step() string {
+	return script.step
+}
+
+// TakeChoices returns the options chosen by CHOOSE blocks since the last
+// call, so the session can log them
+func (script *SessionScript) TakeChoices() []string {
+	chosen := script.chosen
+	script.chosen = nil
+	return chosen
+}
+
+// framesLabel describes the position in every block the script is running
+func (script *SessionScript) framesLabel() string {
+	var labels []string
+	for _, frame := range script.frames {
+		opener := script.Actions[frame.start].Target.Control
+		if frame.branch != "" {
+			labels = append(labels, fmt.Sprintf("choose %s", frame.branch))
+		} else if opener.Duration > 0 {
+			labels = append(labels, fmt.Sprintf("repeat %d for %s", frame.iteration, opener.Duration))
+		} else {
+			labels = append(labels, fmt.Sprintf("repeat %d/%d", frame.iteration, opener.Count))
+		}
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", strings.Join(labels, " > "))
+}
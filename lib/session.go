@@ -1,53 +1,96 @@
 package korra
 
 import (
+	"bufio"
+	"context"
 	"encoding/gob"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"math/rand"
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// ResultEncoder writes a session's results to a file, buffered; they're
+// only guaranteed to be in the file once it's closed.
 type ResultEncoder struct {
 	Name        string
+	Count       int // results written
+	buffer      *bufio.Writer
 	encoder     *gob.Encoder
 	encoderFile io.WriteCloser
 }
 
-// name should be the script path
-func NewResultEncoder(scriptPath string) *ResultEncoder {
-	encoderDir := path.Dir(scriptPath)
-	encoderName := strings.Replace(path.Base(scriptPath), ".txt", ".bin", -1)
-	encoderFullPath := path.Join(encoderDir, encoderName)
-	if encoderFile, err := os.Create(encoderFullPath); err != nil {
-		panic(fmt.Sprintf("Cannot create encoder for results [Path: %s] [session file: %s] => %s", encoderFullPath, scriptPath, err))
-	} else {
-		encoder := gob.NewEncoder(encoderFile)
-		return &ResultEncoder{encoderName, encoder, encoderFile}
+// ResultsPath is where results for the script are stored by default: next
+// to it, with '.bin' instead of '.txt'
+func ResultsPath(scriptPath string) string {
+	return path.Join(path.Dir(scriptPath), strings.Replace(path.Base(scriptPath), ".txt", ".bin", -1))
+}
+
+func NewResultEncoder(resultsPath string) (*ResultEncoder, error) {
+	encoderFile, err := os.Create(resultsPath)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create encoder for results [Path: %s] => %s", resultsPath, err)
 	}
+	buffer := bufio.NewWriter(encoderFile)
+	return &ResultEncoder{
+		Name:        path.Base(resultsPath),
+		buffer:      buffer,
+		encoder:     gob.NewEncoder(buffer),
+		encoderFile: encoderFile,
+	}, nil
 }
 
 func (e *ResultEncoder) AddResult(r *Result) error {
-	return e.encoder.Encode(r)
+	if err := e.encoder.Encode(r); err != nil {
+		return err
+	}
+	e.Count += 1
+	return nil
 }
 
-func (e *ResultEncoder) Close() {
-	e.encoderFile.Close()
+// Close flushes any buffered results and closes the file, returning the
+// first error from either
+func (e *ResultEncoder) Close() error {
+	err := e.buffer.Flush()
+	if closeErr := e.encoderFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 type Session struct {
-	Name     string
-	Path     string
-	Pretend  bool
-	Script   *SessionScript
-	attacker *Attacker
-	logChan  chan string
-	results  chan *Result
-	running  bool
-	stopper  chan struct{}
-	verbose  bool
+	Name       string
+	Path       string
+	Output     string // file results are written to
+	Pretend    bool
+	PauseScale float64 // multiplies every PAUSE, compressing or stretching think time
+	Script     *SessionScript
+	Seed       int64 // combined with the name to seed the session's random choices
+	Vars       *Variables
+	Iterations int           // times to run the script, 0 for no limit
+	Duration   time.Duration // how long to keep running the script, 0 for no limit
+	Observers  []ResultObserver
+	Gate       *Gate          // if set, waited on before every action
+	Capture    *CapturePolicy // if set, which requests to save to the capture file
+	attacker   *Attacker
+	captured   int
+	clientOpts []func(*Attacker)
+	deadline   time.Time
+	finished   int32 // set once the script has run to its end
+	iteration  int
+	logChan    chan string
+	published  *atomic.Value // latest sessionSnapshot, read by other goroutines
+	results    chan *Result
+	sampler    *rand.Rand // for sampling captures, apart from the script's choices
+	stopper    chan struct{}
+	stopping   int32 // set once stopper is closed
+	verbose    bool
+	written    int
 }
 
 func NewSession(scriptPath string, opts []func(*Attacker), logChan chan string, verboseLogging bool) (*Session, error) {
@@ -61,19 +104,41 @@ func NewSession(scriptPath string, opts []func(*Attacker), logChan chan string,
 	}
 	name := path.Base(scriptPath)
 	session := &Session{
-		Name:     name,
-		Path:     scriptPath,
-		Script:   script,
-		attacker: NewAttacker(opts...),
-		logChan:  logChan,
-		results:  make(chan *Result),
-		stopper:  make(chan struct{}),
-		verbose:  verboseLogging,
+		Name:       name,
+		Iterations: 1,
+		Path:       scriptPath,
+		Output:     ResultsPath(scriptPath),
+		PauseScale: 1,
+		Script:     script,
+		Vars:       NewVariables(nil),
+		attacker:   NewAttacker(opts...),
+		clientOpts: opts,
+		logChan:    logChan,
+		published:  &atomic.Value{},
+		results:    make(chan *Result),
+		stopper:    make(chan struct{}),
+		verbose:    verboseLogging,
 	}
 	session.debug("CREATED")
 	return session, nil
 }
 
+// Instance creates a new session running the same script with the same
+// settings and variables, but with its own progress, cookies and results
+// file, all numbered with the given instance
+func (session *Session) Instance(number int) *Session {
+	instance := *session
+	instance.Name = fmt.Sprintf("%s-%d", strings.TrimSuffix(session.Name, ".txt"), number)
+	instance.Output = fmt.Sprintf("%s-%d.bin", strings.TrimSuffix(session.Output, ".bin"), number)
+	instance.Script = session.Script.Copy()
+	instance.Vars = session.Vars.Copy()
+	instance.attacker = NewAttacker(session.clientOpts...)
+	instance.published = &atomic.Value{}
+	instance.results = make(chan *Result)
+	instance.stopper = make(chan struct{})
+	return &instance
+}
+
 // debug sends the message to the global log only if verbose is turned on
 func (session *Session) debug(msg string) {
 	if session.verbose {
@@ -84,97 +149,335 @@ func (session *Session) debug(msg string) {
 // log sends messages to the global log, prefixing it first with the session
 // name and the current progress
 func (session *Session) log(msg string) {
-	if session.logChan != nil {
-		session.logChan <- fmt.Sprintf("%s %s: %s", session.Name, session.Script.ProgressLabel(), msg)
+	if session.logChan == nil {
+		return
+	}
+	session.logChan <- fmt.Sprintf("%s %s: %s", session.Name, session.snapshot().label, msg)
+}
+
+// sessionSnapshot is the progress of a session as of its last action, so
+// it can be read while the session runs
+type sessionSnapshot struct {
+	progress SessionProgress
+	label    string
+}
+
+// publish takes a snapshot of the session's progress; only the goroutine
+// running the script may call it
+func (session *Session) publish() {
+	session.published.Store(session.progress(session.Script.Progress(), session.Script.ProgressLabel(), session.iteration))
+}
+
+// snapshot returns the last one published, or one from the script's
+// expectations if the session hasn't started running it
+func (session *Session) snapshot() sessionSnapshot {
+	if snapshot, ok := session.published.Load().(sessionSnapshot); ok {
+		return snapshot
 	}
+	expected := session.Script.expected
+	return session.progress(SessionProgress{Actions: expected, Complete: expected == 0}, fmt.Sprintf("0/%d", expected), 0)
 }
 
+// Progress reports how many actions the session has run out of how many
+// we expect it to run, over every iteration if there's a limit to them. It's
+// safe to call while the session runs.
 func (session *Session) Progress() SessionProgress {
-	return session.Script.Progress()
+	return session.snapshot().progress
 }
 
-func (session *Session) Run(log chan string) {
-	session.running = true
-	enc := NewResultEncoder(session.Path)
-	go session.process(log)
-	for {
-		select {
-		case result := <-session.results:
-			enc.AddResult(result)
-
-		// wait for the next result (or timeout) then wrap up:
-		case <-session.stopper:
-			session.running = false
-			session.debug("All done or asked to stop, waiting for next result or 5 seconds...")
-			if !session.Pretend {
-				select {
-				case result := <-session.results:
-					enc.AddResult(result)
-				case <-time.After(5 * time.Second):
-				}
+// progress extends the progress of the script through the given iteration
+// to the whole session
+func (session *Session) progress(progress SessionProgress, label string, iteration int) sessionSnapshot {
+	if session.loops() {
+		label = fmt.Sprintf("#%d %s", iteration, label)
+		if done := iteration - 1; done > 0 {
+			progress.Current += done * progress.Actions
+		}
+		iterations := session.Iterations
+		if iterations == 0 || session.Duration > 0 {
+			// with no fixed number we expect just one more
+			iterations = iteration + 1
+		}
+		progress.Actions *= iterations
+		progress.Complete = session.Finished()
+		progress.Percentage = float32(100)
+		if !progress.Complete && progress.Current < progress.Actions {
+			progress.Percentage = (float32(progress.Current) / float32(progress.Actions)) * 100
+		}
+	}
+	return sessionSnapshot{progress: progress, label: label}
+}
+
+// loops returns true if the session may run its script more than once
+func (session *Session) loops() bool {
+	return session.Iterations != 1 || session.Duration > 0
+}
+
+// expired returns true if the session has run for its duration
+func (session *Session) expired() bool {
+	return !session.deadline.IsZero() && !time.Now().Before(session.deadline)
+}
+
+// Run runs the session's script, writing every result to its output file,
+// until the script is done or the session is stopped; when it returns the
+// file is closed, holding every result the session produced. Cancelling ctx
+// cancels any request in flight, which isn't recorded.
+func (session *Session) Run(ctx context.Context) error {
+	enc, err := NewResultEncoder(session.Output)
+	if err != nil {
+		return err
+	}
+	captures := &captureWriter{Name: CapturePath(session.Output)}
+	defer session.attacker.CloseIdleConnections() // so finished sessions don't hold sockets
+	go session.process(ctx)
+	for result := range session.results {
+		for _, observer := range session.Observers {
+			observer.Observe(session.Name, result)
+		}
+		if err = enc.AddResult(result); err != nil {
+			session.log(fmt.Sprintf("Cannot write result to %s: %s", enc.Name, err))
+		}
+		if result.capture != nil {
+			if err = captures.add(result.capture); err != nil {
+				session.log(fmt.Sprintf("Cannot write capture to %s: %s", captures.Name, err))
 			}
-			enc.Close()
-			session.debug("DONE")
-			return
 		}
 	}
+	session.written, session.captured = enc.Count, captures.Count
+	if err = captures.Close(); err != nil {
+		return fmt.Errorf("Cannot close capture file %s: %s", captures.Name, err)
+	}
+	if err = enc.Close(); err != nil {
+		return fmt.Errorf("Cannot close results file %s: %s", session.Output, err)
+	}
+	session.debug("DONE")
+	return nil
 }
 
+// Stop asks the session to stop once the action it's running is done; a
+// PAUSE is cut short. It's safe to call more than once, and before or
+// after the session runs.
 func (session *Session) Stop() {
-	if session.running {
-		session.stopper <- struct{}{}
+	if atomic.CompareAndSwapInt32(&session.stopping, 0, 1) {
+		close(session.stopper)
+	}
+}
+
+// Finished returns true if the session ran its script to the end, rather
+// than being stopped
+func (session *Session) Finished() bool {
+	return atomic.LoadInt32(&session.finished) == 1
+}
+
+// ResultCount returns the number of results written by Run
+func (session *Session) ResultCount() int {
+	return session.written
+}
+
+// CaptureCount returns the number of captures written by Run
+func (session *Session) CaptureCount() int {
+	return session.captured
+}
+
+// stopped returns true if the session has been asked to stop or its
+// context cancelled
+func (session *Session) stopped(ctx context.Context) bool {
+	select {
+	case <-session.stopper:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (session *Session) process(ctx context.Context) {
+	defer close(session.results)
+	session.Script.Random = rand.New(rand.NewSource(session.seed()))
+	if session.Capture != nil {
+		session.attacker.captureBody = session.Capture.MaxBody
+		session.attacker.capturing = true
+		session.sampler = rand.New(rand.NewSource(session.seed()))
+	}
+	if session.Duration > 0 {
+		session.deadline = time.Now().Add(session.Duration)
+	}
+	initial := session.Vars.Copy()
+	for session.iteration = 1; ; session.iteration++ {
+		if session.iteration > 1 {
+			session.Script.Reset()
+			session.Vars = initial.Copy()
+		}
+		session.publish()
+		if session.iteration > 1 {
+			session.debug("Starting iteration")
+		}
+		session.Script.Vars = session.Vars
+		waited := session.runScript(ctx)
+		if session.stopped(ctx) {
+			session.debug("Stopped")
+			return
+		} else if session.expired() || (session.Iterations > 0 && session.iteration >= session.Iterations) {
+			break
+		} else if session.Pretend && session.Iterations == 0 {
+			break // pretending takes no time, so it would never expire
+		} else if !waited {
+			// nothing in this iteration took any time (only comments or
+			// assignments, say, or an IF whose branch wasn't taken), so back
+			// off rather than spin until the session expires
+			session.debug("Iteration made no requests or pauses, backing off")
+			session.pause(ctx, idleIterationMillis)
+		}
 	}
+	atomic.StoreInt32(&session.finished, 1)
+	session.publish()
 }
 
-func (session *Session) process(log chan string) {
-	for session.Script.ActionsRemain() {
+// idleIterationMillis is how long to wait before running the script again
+// after an iteration that neither made a request nor paused
+const idleIterationMillis = 100
+
+// runScript runs through the actions of the script once, or until the
+// session expires, and returns whether it made any request or paused
+func (session *Session) runScript(ctx context.Context) (waited bool) {
+	for session.Script.ActionsRemain() && !session.expired() && !session.stopped(ctx) {
+		if session.Gate != nil {
+			select {
+			case <-session.Gate.Open():
+			case <-session.stopper:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
 		action := session.Script.NextAction()
+		session.publish()
+		for _, branch := range session.Script.TakeChoices() {
+			session.log(fmt.Sprintf("Chose branch %s", branch))
+		}
 		target := action.Target
 		if target.IsComment() {
 			session.log(target.Comment)
 		} else if target.IsPause() {
-			session.pause(target.PauseTime)
+			session.pause(ctx, session.thinkTime(target.Pause))
+			waited = true
+		} else if target.IsAssignment() {
+			session.assign(action)
+		} else if target.IsCookies() {
+			session.cookies(target.Cookies)
 		} else {
-			session.doHttp(action)
+			session.doHttp(ctx, action)
+			waited = true
 		}
 	}
-	session.stopper <- struct{}{}
+	return waited
+}
+
+// seed combines the run's seed with a hash of the session name, so every
+// session makes different random choices but makes the same ones given the
+// same run seed
+func (session *Session) seed() int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(session.Name))
+	return session.Seed ^ int64(hash.Sum64())
+}
+
+// thinkTime returns the milliseconds to pause for the given think time,
+// drawn at random for the session if needed and then scaled
+func (session *Session) thinkTime(think *ThinkTime) int {
+	return int(float64(think.Millis(session.Script.Random)) * session.PauseScale)
 }
 
-func (session *Session) pause(pauseMillis int) {
+func (session *Session) pause(ctx context.Context, pauseMillis int) {
 	if session.Pretend {
 		session.log(fmt.Sprintf("Sleeping (pretend) (%d ms)...", pauseMillis))
 		return
 	}
 	session.debug(fmt.Sprintf("Sleeping (%d ms)...", pauseMillis))
+	wait := time.Duration(pauseMillis) * time.Millisecond
+	if !session.deadline.IsZero() {
+		if remaining := session.deadline.Sub(time.Now()); remaining < wait {
+			wait = remaining // no sense waiting past the end
+		}
+	}
+	session.sleep(ctx, wait)
+}
+
+// sleep waits for the given time, or until the session is stopped
+func (session *Session) sleep(ctx context.Context, wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
 	select {
 	case <-session.stopper:
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (session *Session) assign(action *SessionAction) {
+	target := action.Target
+	value, err := action.Scope(session.Vars).Expand(target.VarValue)
+	if err != nil {
+		session.log(fmt.Sprintf("Cannot SET %s: %s", target.VarName, err))
 		return
-	case <-time.After(time.Duration(pauseMillis) * time.Millisecond):
+	}
+	session.debug(fmt.Sprintf("SET %s => %s", target.VarName, value))
+	session.Vars.Set(target.VarName, value)
+}
+
+func (session *Session) cookies(command string) {
+	session.debug(fmt.Sprintf("COOKIES %s", command))
+	switch command {
+	case "clear":
+		session.attacker.ClearCookies()
+	case "on":
+		session.attacker.EnableCookies()
+	case "off":
+		session.attacker.DisableCookies()
 	}
 }
 
-func (session *Session) doHttp(action *SessionAction) {
+func (session *Session) doHttp(ctx context.Context, action *SessionAction) {
 	target := action.Target
 	if session.Pretend {
 		session.log(fmt.Sprintf("%d (pretend) => %s %s, %d ms",
 			200, target.Method, target.URL, 0))
 		return
 	}
-	targeter := func() (*Target, error) { return target, nil }
+	scope := action.Scope(session.Vars)
+	targeter := func() (*Target, error) { return target.Expand(scope) }
 
 	// retry a request if we're supposed to poll
 	requests := 1
 	for {
 		timestamp := time.Now()
-		result := session.attacker.Hit(targeter, timestamp, requests)
+		result := session.attacker.Hit(ctx, targeter, timestamp, requests, session.Vars)
+		if ctx.Err() != nil {
+			session.debug(fmt.Sprintf("Cancelled => %s %s", result.Method, result.Path))
+			return
+		}
+		result.Session = session.Name
+		result.Line = action.Position()
+		result.Step = session.Script.Step()
+		result.Iteration = session.iteration
+		result.Repeat = session.Script.Repeat()
+		result.Branch = session.Script.Branch()
+		session.keepCapture(result)
+		session.Script.Record(result)
 		session.debug(fmt.Sprintf("%d => %s %s, %d ms",
 			result.Code, result.Method, result.Path, int64(result.Latency/time.Millisecond)))
+		if result.Error != "" && result.Code == 0 {
+			session.debug(fmt.Sprintf("Error => %s", result.Error))
+		}
 		session.results <- result
 		if target.Poller.ShouldRetry(requests, int(result.Code)) {
 			pauseMillis := target.Poller.WaitBetweenPolls
 			session.debug(fmt.Sprintf("Attempt %d requires retry, %d ms pause until next poll", requests, pauseMillis))
-			time.Sleep(time.Duration(pauseMillis) * time.Millisecond)
+			session.sleep(ctx, time.Duration(pauseMillis)*time.Millisecond)
+			if session.stopped(ctx) {
+				return
+			}
 			requests += 1
 		} else {
 			break
@@ -182,6 +485,20 @@ func (session *Session) doHttp(action *SessionAction) {
 	}
 }
 
+// keepCapture labels the result's capture with where it came from, or drops
+// it if the capture policy doesn't want it
+func (session *Session) keepCapture(result *Result) {
+	if result.capture == nil {
+		return
+	} else if session.Capture == nil || !session.Capture.captures(result, session.sampler.Float64()) {
+		result.capture = nil
+		return
+	}
+	result.capture.Session = result.Session
+	result.capture.Line = result.Line
+	result.capture.Iteration = result.Iteration
+}
+
 func retryable(code uint16) bool {
 	return code == 502 || code == 503 || code == 504
 }
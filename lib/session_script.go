@@ -4,24 +4,47 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/url"
 	"os"
 	"path"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
 type SessionProgress struct {
-	Complete   bool
-	Actions    int
-	Current    int
-	Percentage float32
+	Complete   bool    `json:"complete"`
+	Actions    int     `json:"actions"`
+	Current    int     `json:"current"`
+	Percentage float32 `json:"percentage"`
 }
 
 type SessionScript struct {
-	Actions []*SessionAction
-	Current int
+	Actions  []*SessionAction
+	Current  int
+	Vars     *Variables // checked by IF conditions
+	Random   *rand.Rand // picks CHOOSE options
+	chosen   []string
+	executed int
+	expected int
+	frames   []*scriptFrame
+	last     *Result
+	step     string
+}
+
+// Copy creates a script with the same actions, ready to run from the start
+func (script *SessionScript) Copy() *SessionScript {
+	return &SessionScript{Actions: script.Actions, expected: script.expected}
+}
+
+// Reset puts the script back at its start, to run again
+func (script *SessionScript) Reset() {
+	script.Current = 0
+	script.chosen = nil
+	script.executed = 0
+	script.frames = nil
+	script.last = nil
+	script.step = ""
 }
 
 func (script *SessionScript) ActionCount() int {
@@ -29,6 +52,7 @@ func (script *SessionScript) ActionCount() int {
 }
 
 func (script *SessionScript) ActionsRemain() bool {
+	script.advance()
 	return len(script.Actions) > script.Current
 }
 
@@ -41,23 +65,35 @@ func (script *SessionScript) IsValid() bool {
 	return true
 }
 
+// NextAction returns the next action for the session to run, first
+// running any control actions (REPEAT, IF, GOTO...) that determine what
+// that is
 func (script *SessionScript) NextAction() *SessionAction {
+	script.advance()
 	action := script.Actions[script.Current]
 	script.Current += 1
+	script.executed += 1
 	return action
 }
 
+// Progress reports how many actions the session has run out of how many
+// we expect it to run, counting every iteration of a REPEAT block.
 func (script *SessionScript) Progress() SessionProgress {
+	complete := script.Current == script.ActionCount()
+	percentage := float32(100)
+	if !complete && script.executed < script.expected {
+		percentage = (float32(script.executed) / float32(script.expected)) * 100
+	}
 	return SessionProgress{
-		Actions:    script.ActionCount(),
-		Current:    script.Current,
-		Complete:   script.Current == script.ActionCount(),
-		Percentage: (float32(script.Current) / float32(script.ActionCount())) * 100,
+		Actions:    script.expected,
+		Current:    script.executed,
+		Complete:   complete,
+		Percentage: percentage,
 	}
 }
 
 func (script *SessionScript) ProgressLabel() string {
-	return fmt.Sprintf("%d/%d", script.Current, script.ActionCount())
+	return fmt.Sprintf("%d/%d%s", script.executed, script.expected, script.framesLabel())
 }
 
 // NewScript creates a new script of SessionAction objects from the given
@@ -69,24 +105,36 @@ func NewScript(scriptPath string) (*SessionScript, error) {
 	var (
 		err            error
 		scannedActions []*SessionAction
-		script         io.Reader
+		script         io.ReadCloser
 		validActions   []*SessionAction
 	)
 
 	if script, err = scriptFile(scriptPath); err != nil {
 		return nil, err
 	}
-	if scannedActions, err = ScanActions(script); err != nil {
+	scannedActions, err = ScanActions(script)
+	script.Close()
+	if err != nil {
+		return nil, err
+	}
+	if scannedActions, err = expandIncludes(scannedActions, scriptPath); err != nil {
 		return nil, err
 	}
 	scriptDir := path.Dir(scriptPath)
 	for _, action := range scannedActions {
-		if err := action.CreateTarget(scriptDir); err != nil {
+		if action.Error != nil {
+			return nil, action.Error
+		}
+		if err := action.CreateTarget(action.dir(scriptDir)); err != nil {
 			return nil, err
 		}
 		validActions = append(validActions, action)
 	}
-	return &SessionScript{Actions: validActions, Current: 0}, nil
+	parsed := &SessionScript{Actions: validActions, Current: 0}
+	if err = parsed.link(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
 }
 
 // CheckScript creates a new script of SessionAction objects from
@@ -100,18 +148,59 @@ func CheckScript(scriptPath string) (*SessionScript, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer script.Close()
 	if actions, err := ScanActions(script); err != nil {
 		return nil, err
+	} else if actions, err = expandIncludes(actions, scriptPath); err != nil {
+		return nil, err
 	} else {
 		scriptDir := path.Dir(scriptPath)
 		for _, action := range actions {
-			action.CreateTarget(scriptDir)
+			if action.Error == nil {
+				action.CreateTarget(action.dir(scriptDir))
+			}
+		}
+		parsed := &SessionScript{Actions: actions, Current: 0}
+		parsed.link()
+		return parsed, nil
+	}
+}
+
+// CheckReferences marks every action referencing a variable that can't be
+// resolved from vars (or the parameters of the INCLUDE it came from), nor
+// assigned by any SET or EXTRACT in the script. It returns the number of
+// actions marked.
+func (script *SessionScript) CheckReferences(vars *Variables) int {
+	defined := make(map[string]bool)
+	for _, action := range script.Actions {
+		if action.Target == nil {
+			continue
+		}
+		if action.Target.IsAssignment() {
+			defined[action.Target.VarName] = true
+		}
+		for _, extractor := range action.Target.Extractors {
+			defined[extractor.Name] = true
+		}
+	}
+	unresolved := 0
+	for _, action := range script.Actions {
+		if action.Error != nil || action.Target == nil {
+			continue
+		}
+		scope := action.Scope(vars)
+		for _, name := range action.Target.References() {
+			if _, ok := scope.Get(name); !ok && !defined[name] {
+				action.BadLine(0, fmt.Sprintf("Unresolved variable ${%s}", name))
+				unresolved += 1
+				break
+			}
 		}
-		return &SessionScript{Actions: actions, Current: 0}, nil
 	}
+	return unresolved
 }
 
-func scriptFile(scriptPath string) (io.Reader, error) {
+func scriptFile(scriptPath string) (io.ReadCloser, error) {
 	fi, err := os.Stat(scriptPath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading session file %s: %s", scriptPath, err)
@@ -137,17 +226,47 @@ var (
 )
 
 type SessionAction struct {
-	Raw    string
-	Line   int
-	Error  error
-	Target *Target
+	Raw        string
+	File       string // fragment the action came from, empty for the script itself
+	Line       int    // line within File, or within the script
+	Error      error
+	Target     *Target
+	includedBy *SessionAction
+	params     map[string]string // given to an INCLUDE, for the fragment's Scope
 }
 
 func (action *SessionAction) BadLine(offset int, message string) error {
-	action.Error = fmt.Errorf("Line %d: %s", action.Line+offset, message)
+	location := action.location(offset)
+	action.Error = fmt.Errorf("%s%s: %s", strings.ToUpper(location[:1]), location[1:], message)
 	return action.Error
 }
 
+// Position is a short form of where the action is: just the line number
+// for actions in the script, or 'file:line' for those from a fragment
+func (action *SessionAction) Position() string {
+	if action.File == "" {
+		return fmt.Sprintf("%d", action.Line)
+	}
+	return fmt.Sprintf("%s:%d", action.File, action.Line)
+}
+
+// location describes where the action is for a message, including the
+// INCLUDE chain that brought it in from a fragment
+func (action *SessionAction) location(offset int) string {
+	if action.File == "" {
+		return fmt.Sprintf("line %d", action.Line+offset)
+	}
+	return fmt.Sprintf("line %d of %s (included from %s)", action.Line+offset, action.File, action.includedBy.location(0))
+}
+
+// dir is where the action's '@body' references are found
+func (action *SessionAction) dir(scriptDir string) string {
+	if action.File == "" {
+		return scriptDir
+	}
+	return path.Dir(action.File)
+}
+
 // CreateTarget parses the string stored in the `SessionAction.Raw`
 // property and checks:
 // * if it's a valid action
@@ -155,6 +274,16 @@ func (action *SessionAction) BadLine(offset int, message string) error {
 // * that a header value is specified (if the action lists any request headers)
 // * that the file with the request body exists (if one is specified)
 // * that the polling parameters are valid ones (if polling is being used)
+// * that the extract directives have a name and known source (if any)
+// * that the assertions are well-formed (if any)
+// * that SET has a valid variable name and a value
+// * that COOKIES has a valid argument
+// * that REPEAT has a valid count or duration
+// * that IF has a valid condition, and LABEL and GOTO a label name
+// * that OPTION has a valid weight
+//
+// INCLUDE actions are replaced by the fragments they name before this runs,
+// see `expandIncludes`.
 func (action *SessionAction) CreateTarget(scriptDir string) error {
 	tgt := NewTarget()
 	lines := strings.Split(action.Raw, "\n")
@@ -162,17 +291,45 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 	var tokens []string
 	if strings.HasPrefix(firstLine, "PAUSE") {
 		tokens = strings.SplitN(firstLine, " ", 2)
-		pauseTime, err := strconv.Atoi(strings.TrimSpace(tokens[1]))
+		if len(tokens) < 2 {
+			return action.BadLine(0, fmt.Sprintf(errThinkTime, ""))
+		}
+		pause, err := NewThinkTime(strings.TrimSpace(tokens[1]))
 		if err != nil {
-			return action.BadLine(0, fmt.Sprintf("Expected int as argument to PAUSE, got '%s'", tokens[1]))
+			return action.BadLine(0, err.Error())
 		}
-		tgt.PauseTime = pauseTime
+		tgt.Pause = pause
 		action.Target = tgt
 		return nil
 	} else if strings.HasPrefix(firstLine, "COMMENT") {
 		tgt.Comment = strings.SplitN(firstLine, " ", 2)[1]
 		action.Target = tgt
 		return nil
+	} else if setCommand.MatchString(firstLine) {
+		tokens = strings.SplitN(firstLine, " ", 3)
+		if len(tokens) < 3 || !IsVariableName(tokens[1]) {
+			return action.BadLine(0, fmt.Sprintf("Expected variable name and value as arguments to SET, got '%s'", firstLine))
+		}
+		tgt.VarName = tokens[1]
+		tgt.VarValue = strings.TrimSpace(tokens[2])
+		action.Target = tgt
+		return nil
+	} else if cookiesCommand.MatchString(firstLine) {
+		tokens = strings.Fields(firstLine)
+		if len(tokens) != 2 || (tokens[1] != "clear" && tokens[1] != "on" && tokens[1] != "off") {
+			return action.BadLine(0, fmt.Sprintf("Expected clear, on or off as argument to COOKIES, got '%s'", firstLine))
+		}
+		tgt.Cookies = tokens[1]
+		action.Target = tgt
+		return nil
+	} else if isControlCommand(firstLine) {
+		control, err := newScriptControl(firstLine)
+		if err != nil {
+			return action.BadLine(0, err.Error())
+		}
+		tgt.Control = control
+		action.Target = tgt
+		return nil
 	}
 
 	// everything else starts with a URL action, possibly preceded by POLL
@@ -194,8 +351,11 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 		checkUrl = tokens[1]
 	}
 
-	if _, err := url.ParseRequestURI(checkUrl); err != nil {
-		return action.BadLine(0, fmt.Sprintf("Invalid URL: %s", checkUrl))
+	// URLs with variable references can only be checked once they're resolved
+	if !HasReferences(checkUrl) {
+		if _, err := url.ParseRequestURI(checkUrl); err != nil {
+			return action.BadLine(0, fmt.Sprintf("Invalid URL: %s", checkUrl))
+		}
 	}
 	tgt.URL = checkUrl
 
@@ -221,6 +381,18 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 			if err := tgt.Poller.FillFromLine(pollingConfig); err != nil {
 				return action.BadLine(idx, fmt.Sprintf("Bad poll params '%s': %s", line, err))
 			}
+		} else if strings.HasPrefix(line, "EXTRACT ") {
+			extractor, err := NewExtractor(strings.TrimSpace(line[8:]))
+			if err != nil {
+				return action.BadLine(idx, fmt.Sprintf("Bad extract '%s': %s", line, err))
+			}
+			tgt.Extractors = append(tgt.Extractors, extractor)
+		} else if strings.HasPrefix(line, "ASSERT ") {
+			assertion, err := NewAssertion(strings.TrimSpace(line[7:]))
+			if err != nil {
+				return action.BadLine(idx, fmt.Sprintf("Bad assertion '%s': %s", line, err))
+			}
+			tgt.Assertions = append(tgt.Assertions, assertion)
 		} else {
 			headerTokens := strings.SplitN(line, ":", 2)
 			if len(headerTokens) < 2 {
@@ -239,13 +411,15 @@ func (action *SessionAction) CreateTarget(scriptDir string) error {
 }
 
 func (action *SessionAction) String() string {
-	return fmt.Sprintf("[%d] %s", action.Line, action.Target)
+	return fmt.Sprintf("[%s] %s", action.Position(), action.Target)
 }
 
 var (
 	externalCommentCommand = regexp.MustCompile("^COMMENT")
 	internalCommentCommand = regexp.MustCompile("^//")
 	pauseCommand           = regexp.MustCompile("^PAUSE")
+	setCommand             = regexp.MustCompile("^SET\\s")
+	cookiesCommand         = regexp.MustCompile("^COOKIES(\\s|$)")
 )
 
 // Given a file with:
@@ -311,5 +485,7 @@ func ScanActions(reader io.Reader) ([]*SessionAction, error) {
 }
 
 func isSingleLineCommand(line string) bool {
-	return pauseCommand.MatchString(line) || externalCommentCommand.MatchString(line)
+	return pauseCommand.MatchString(line) || externalCommentCommand.MatchString(line) ||
+		setCommand.MatchString(line) || cookiesCommand.MatchString(line) || includeCommand.MatchString(line) ||
+		isControlCommand(line)
 }
@@ -0,0 +1,265 @@
+package korra
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// writeScript writes the script text to a temporary directory and returns
+// its path along with a function to remove it
+func writeScript(t *testing.T, text string) (string, func()) {
+	dir, err := ioutil.TempDir("", "korra-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPath := path.Join(dir, "script.txt")
+	if err = ioutil.WriteFile(scriptPath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return scriptPath, func() { os.RemoveAll(dir) }
+}
+
+// runScript walks through the script and returns the raw text of every
+// action a session would run, along with the REPEAT iteration for each
+func runScript(script *SessionScript) ([]string, []int) {
+	var ran []string
+	var repeats []int
+	for script.ActionsRemain() {
+		action := script.NextAction()
+		ran = append(ran, action.Raw)
+		repeats = append(repeats, script.Repeat())
+	}
+	return ran, repeats
+}
+
+func TestScriptRepeat(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `GET http://foo/start
+REPEAT 2
+GET http://foo/outer
+REPEAT 3
+GET http://foo/inner
+END
+END
+REPEAT 0
+GET http://foo/never
+END
+GET http://foo/finish
+`)
+	defer cleanup()
+	script, err := NewScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := script.Progress().Actions; got != 10 {
+		t.Errorf("want 10 expected actions, got %d", got)
+	}
+	ran, repeats := runScript(script)
+	want := "start outer inner inner inner outer inner inner inner finish"
+	got := strings.Replace(strings.Join(ran, " "), "GET http://foo/", "", -1)
+	if got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if wantRepeats := []int{0, 1, 1, 2, 3, 2, 1, 2, 3, 0}; !equalInts(repeats, wantRepeats) {
+		t.Errorf("want repeats: %v, got: %v", wantRepeats, repeats)
+	}
+	if progress := script.Progress(); !progress.Complete || progress.Current != 10 {
+		t.Errorf("want complete at 10 actions, got: %#v", progress)
+	}
+}
+
+func TestScriptUnbalancedBlocks(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `REPEAT 2
+GET http://foo/bar
+END
+END
+REPEAT for 5m
+GET http://foo/baz
+`)
+	defer cleanup()
+	if _, err := NewScript(scriptPath); err == nil {
+		t.Fatal("expected error for unbalanced blocks")
+	}
+	script, _ := CheckScript(scriptPath)
+	var errs []string
+	for _, action := range script.Actions {
+		if action.Error != nil {
+			errs = append(errs, action.Error.Error())
+		}
+	}
+	want := "Line 4: END without a matching REPEAT, IF or CHOOSE|Line 5: REPEAT without a matching END"
+	if got := strings.Join(errs, "|"); got != want {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestScriptConditionals(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `SET cart empty
+LABEL top
+GET http://foo/cart
+IF status=404
+POST http://foo/cart
+SET cart full
+GOTO top
+ELSE
+IF cart=empty
+GET http://foo/never
+END
+GET http://foo/checkout
+END
+`)
+	defer cleanup()
+	script, err := NewScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script.Vars = NewVariables(nil)
+	var ran []string
+	status := uint16(404)
+	for script.ActionsRemain() {
+		action := script.NextAction()
+		if target := action.Target; target.IsAssignment() {
+			script.Vars.Set(target.VarName, target.VarValue)
+		} else {
+			ran = append(ran, target.Method+" "+strings.TrimPrefix(target.URL, "http://foo/"))
+			script.Record(&Result{Code: status})
+			status = 200
+		}
+	}
+	want := "GET cart|POST cart|GET cart|GET checkout"
+	if got := strings.Join(ran, "|"); got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestScriptBadControl(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `ELSE
+IF status=200
+ELSE
+ELSE
+END
+GOTO nowhere
+REPEAT 2
+LABEL inside
+END
+GOTO inside
+LABEL twice
+CHOOSE
+GET http://foo/bar
+OPTION 0
+END
+LABEL twice
+IF status
+END
+`)
+	defer cleanup()
+	script, _ := CheckScript(scriptPath)
+	var errs []string
+	for _, action := range script.Actions {
+		if action.Error != nil {
+			errs = append(errs, action.Error.Error())
+		}
+	}
+	want := []string{
+		"Line 1: ELSE without a matching IF",
+		"Line 4: IF already has an ELSE on line 3",
+		"Line 6: GOTO undefined label 'nowhere'",
+		"Line 10: Label 'inside' on line 8 is inside a REPEAT or CHOOSE block and can't be reached from outside it",
+		"Line 12: Expected OPTION on the line after CHOOSE",
+		"Line 16: Label 'twice' already defined on line 11",
+		"Line 17: Expected condition like 'status=404' or 'name~regex', got 'status'",
+	}
+	if got := strings.Join(errs, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("want:\n%s\ngot:\n%s", strings.Join(want, "\n"), got)
+	}
+}
+
+func TestScriptChoose(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `REPEAT 1000
+CHOOSE
+OPTION 70 browse
+GET http://foo/browse
+OPTION 30
+GET http://foo/search
+OPTION 0 never
+GET http://foo/never
+END
+END
+`)
+	defer cleanup()
+	run := func(seed int64) (map[string]int, string) {
+		script, err := NewScript(scriptPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		script.Random = rand.New(rand.NewSource(seed))
+		counts := make(map[string]int)
+		var sequence []string
+		for script.ActionsRemain() {
+			action := script.NextAction()
+			counts[script.Branch()] += 1
+			sequence = append(sequence, action.Target.URL)
+			if !strings.HasSuffix(action.Target.URL, map[string]string{"browse": "browse", "line 5": "search"}[script.Branch()]) {
+				t.Fatalf("ran %s in branch %s", action.Target.URL, script.Branch())
+			}
+		}
+		return counts, strings.Join(sequence, " ")
+	}
+	counts, first := run(42)
+	if counts["never"] != 0 || counts["browse"]+counts["line 5"] != 1000 {
+		t.Fatalf("bad branch counts: %v", counts)
+	}
+	if counts["browse"] < 600 || counts["browse"] > 800 {
+		t.Errorf("want ~700 browse, got %d", counts["browse"])
+	}
+	if _, second := run(42); first != second {
+		t.Errorf("same seed should choose the same options")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScriptStep(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `GET http://foo/home
+STEP login
+GET http://foo/login
+POST http://foo/login
+STEP
+GET http://foo/account
+`)
+	defer cleanup()
+	script, err := NewScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for pass := 0; pass < 2; pass++ {
+		for script.ActionsRemain() {
+			script.NextAction()
+			steps = append(steps, script.Step())
+		}
+		script.Reset()
+	}
+	if got, want := strings.Join(steps, ","), ",login,login,,,login,login,"; got != want {
+		t.Errorf("want steps %s, got %s", want, got)
+	}
+
+	scriptPath, cleanup = writeScript(t, "STEP add to cart\n")
+	defer cleanup()
+	if _, err = NewScript(scriptPath); err == nil || !strings.Contains(err.Error(), "single step name") {
+		t.Errorf("want error for STEP with spaces, got %v", err)
+	}
+}
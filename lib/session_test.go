@@ -0,0 +1,185 @@
+package korra
+
+import (
+	"context"
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSessionIterations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	scriptPath, cleanup := writeScript(t, "GET "+server.URL+"/one\nGET "+server.URL+"/two\n")
+	defer cleanup()
+
+	session, err := NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Iterations = 3
+	results := runSession(session)
+	if progress := session.Progress(); !progress.Complete || progress.Actions != 6 || progress.Current != 6 {
+		t.Errorf("want 6/6 actions complete, got %+v", progress)
+	}
+
+	if len(results) != 6 {
+		t.Fatalf("want 6 results, got %d", len(results))
+	}
+	for idx, result := range results {
+		if want := idx/2 + 1; result.Iteration != want {
+			t.Errorf("result %d: want iteration %d, got %d", idx, want, result.Iteration)
+		}
+	}
+}
+
+func TestSessionDuration(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, "PAUSE 30\n")
+	defer cleanup()
+
+	session, err := NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Iterations = 0
+	session.Duration = 100 * time.Millisecond
+	started := time.Now()
+	runSession(session)
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("want session to run for about 100ms, took %s", elapsed)
+	}
+	if session.iteration < 3 {
+		t.Errorf("want at least 3 iterations, got %d", session.iteration)
+	}
+}
+
+func TestSessionDurationIdle(t *testing.T) {
+	// none of these take any time, so without backing off the session
+	// would spin through iterations until it expired
+	scriptPath, cleanup := writeScript(t, "COMMENT nothing to do\nSTEP idle\nIF missing=1\nPAUSE 30\nEND\n")
+	defer cleanup()
+
+	session, err := NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Iterations = 0
+	session.Duration = 250 * time.Millisecond
+	started := time.Now()
+	runSession(session)
+	if elapsed := time.Since(started); elapsed < 250*time.Millisecond || elapsed > time.Second {
+		t.Errorf("want session to run for about 250ms, took %s", elapsed)
+	}
+	if session.iteration > 5 {
+		t.Errorf("want a few iterations at most, got %d", session.iteration)
+	}
+}
+
+func TestSessionResultIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	scriptPath, cleanup := writeScript(t, "GET "+server.URL+"/home\nSTEP browse\nGET "+server.URL+"/catalog\n")
+	defer cleanup()
+
+	session, err := NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Iterations = 2
+	results := runSession(session)
+	if len(results) != 4 {
+		t.Fatalf("want 4 results, got %d", len(results))
+	}
+	for idx, want := range []Result{
+		{Session: "script.txt", Line: "1", Iteration: 1},
+		{Session: "script.txt", Line: "3", Step: "browse", Iteration: 1},
+		{Session: "script.txt", Line: "1", Iteration: 2},
+		{Session: "script.txt", Line: "3", Step: "browse", Iteration: 2},
+	} {
+		got := results[idx]
+		if got.Session != want.Session || got.Line != want.Line || got.Step != want.Step || got.Iteration != want.Iteration {
+			t.Errorf("result %d: want %s line %s step '%s' iteration %d, got %s line %s step '%s' iteration %d", idx,
+				want.Session, want.Line, want.Step, want.Iteration, got.Session, got.Line, got.Step, got.Iteration)
+		}
+	}
+}
+
+// runSession processes the session's script and returns the results it
+// sends, without writing them anywhere
+func runSession(session *Session) []*Result {
+	var results []*Result
+	go session.process(context.Background())
+	for result := range session.results {
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestSessionStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	scriptPath, cleanup := writeScript(t, "GET "+server.URL+"/one\nPAUSE 10000\nGET "+server.URL+"/two\n")
+	defer cleanup()
+
+	session, err := NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		session.Stop()
+		session.Stop() // safe to repeat
+	}()
+	started := time.Now()
+	if err = session.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("want stop to cut the pause short, took %s", elapsed)
+	}
+	if session.Finished() || session.ResultCount() != 1 {
+		t.Errorf("want unfinished session with 1 result, got finished %t with %d", session.Finished(), session.ResultCount())
+	}
+
+	in, err := os.Open(session.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	var result Result
+	if err = gob.NewDecoder(in).Decode(&result); err != nil || result.Path != "/one" {
+		t.Errorf("want result for /one in %s, got %+v (%v)", session.Output, result, err)
+	}
+}
+
+func TestSessionGate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	scriptPath, cleanup := writeScript(t, "GET "+server.URL+"/one\nGET "+server.URL+"/two\n")
+	defer cleanup()
+
+	session, err := NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Gate = NewGate()
+	session.Gate.Pause()
+	done := make(chan []*Result)
+	go func() { done <- runSession(session) }()
+	time.Sleep(100 * time.Millisecond)
+	if progress := session.Progress(); progress.Current != 0 {
+		t.Errorf("want no actions run while paused, got %+v", progress)
+	}
+	session.Gate.Resume()
+	select {
+	case results := <-done:
+		if len(results) != 2 {
+			t.Errorf("want 2 results once resumed, got %d", len(results))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session still waiting after resume")
+	}
+}
@@ -0,0 +1,177 @@
+package korra
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// UDPSink forwards every result to a metrics server over UDP as it
+// arrives, in StatsD or InfluxDB line protocol, each tagged with its
+// session, method, path bucket and status. Lines are batched into packets
+// sent when full or every second. Sessions never wait on it: results are
+// queued, and once the queue is full any more are dropped (and counted)
+// until the sink catches up. It's a ResultObserver.
+type UDPSink struct {
+	Addr    string
+	Format  string
+	conn    net.Conn
+	format  func(buf []byte, session string, r *Result) []byte
+	queue   chan sinkResult
+	dropped uint64
+	done    chan struct{}
+}
+
+type sinkResult struct {
+	session string
+	result  *Result
+}
+
+const (
+	sinkQueueSize  = 10000
+	sinkPacketSize = 1432 // fits in an ethernet frame, with room for headers
+	sinkFlushEvery = time.Second
+)
+
+// NewStatsDSink sends each result to the address as StatsD metrics, with
+// tags in the DogStatsD style understood by Telegraf, Datadog and the
+// Prometheus statsd_exporter:
+//
+//    korra.requests:1|c|#session:login.txt,method:GET,bucket:/users/*,status:200
+//    korra.latency:12.5|ms|#session:login.txt,method:GET,bucket:/users/*,status:200
+//    korra.failures:1|c|#...                   (only for failed results)
+func NewStatsDSink(addr string) (*UDPSink, error) {
+	return newUDPSink(addr, "statsd", formatStatsD)
+}
+
+// NewInfluxSink sends each result to the address as an InfluxDB line:
+//
+//    korra_result,session=login.txt,method=GET,bucket=/users/*,status=200 latency_ms=12.5,bytes_in=512i,bytes_out=0i,failed=false 1465839830100400200
+func NewInfluxSink(addr string) (*UDPSink, error) {
+	return newUDPSink(addr, "influx", formatInflux)
+}
+
+func newUDPSink(addr, name string, format func([]byte, string, *Result) []byte) (*UDPSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot send %s metrics to %s: %s", name, addr, err)
+	}
+	sink := &UDPSink{
+		Addr:   addr,
+		Format: name,
+		conn:   conn,
+		format: format,
+		queue:  make(chan sinkResult, sinkQueueSize),
+		done:   make(chan struct{}),
+	}
+	go sink.send()
+	return sink, nil
+}
+
+// Observe queues the result to be sent, or drops it if the queue is full
+func (sink *UDPSink) Observe(session string, r *Result) {
+	select {
+	case sink.queue <- sinkResult{session, r}:
+	default:
+		atomic.AddUint64(&sink.dropped, 1)
+	}
+}
+
+// Dropped returns how many results were dropped because the queue was full
+func (sink *UDPSink) Dropped() uint64 {
+	return atomic.LoadUint64(&sink.dropped)
+}
+
+// Close sends whatever is queued and closes the connection; nothing may be
+// observed after it's called
+func (sink *UDPSink) Close() error {
+	close(sink.queue)
+	<-sink.done
+	return sink.conn.Close()
+}
+
+func (sink *UDPSink) String() string {
+	return fmt.Sprintf("%s at %s", sink.Format, sink.Addr)
+}
+
+// send batches lines from the queue into packets until it's closed; UDP
+// errors (like nobody listening) are ignored, there's no one to tell
+func (sink *UDPSink) send() {
+	defer close(sink.done)
+	ticker := time.NewTicker(sinkFlushEvery)
+	defer ticker.Stop()
+	packet := make([]byte, 0, sinkPacketSize)
+	line := make([]byte, 0, 512)
+	flush := func() {
+		if len(packet) > 0 {
+			sink.conn.Write(packet)
+			packet = packet[:0]
+		}
+	}
+	for {
+		select {
+		case <-ticker.C:
+			flush()
+		case queued, ok := <-sink.queue:
+			if !ok {
+				flush()
+				return
+			}
+			line = sink.format(line[:0], queued.session, queued.result)
+			if len(packet)+len(line) > sinkPacketSize {
+				flush()
+			}
+			packet = append(packet, line...)
+		}
+	}
+}
+
+var statsDTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func formatStatsD(buf []byte, session string, r *Result) []byte {
+	tags := fmt.Sprintf("|#session:%s,method:%s,bucket:%s,status:%d\n",
+		statsDTagEscaper.Replace(session), statsDTagEscaper.Replace(r.Method),
+		statsDTagEscaper.Replace(bucketPath(r.Path)), r.Code)
+	buf = append(buf, "korra.requests:1|c"...)
+	buf = append(buf, tags...)
+	buf = append(buf, "korra.latency:"...)
+	buf = strconv.AppendFloat(buf, float64(r.Latency)/float64(time.Millisecond), 'f', -1, 64)
+	buf = append(buf, "|ms"...)
+	buf = append(buf, tags...)
+	if r.Failed() {
+		buf = append(buf, "korra.failures:1|c"...)
+		buf = append(buf, tags...)
+	}
+	return buf
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`, "\n", " ")
+
+func formatInflux(buf []byte, session string, r *Result) []byte {
+	method := r.Method
+	if method == "" {
+		method = "none" // empty tag values aren't allowed
+	}
+	buf = append(buf, "korra_result,session="...)
+	buf = append(buf, influxTagEscaper.Replace(session)...)
+	buf = append(buf, ",method="...)
+	buf = append(buf, influxTagEscaper.Replace(method)...)
+	buf = append(buf, ",bucket="...)
+	buf = append(buf, influxTagEscaper.Replace(bucketPath(r.Path))...)
+	buf = append(buf, ",status="...)
+	buf = strconv.AppendUint(buf, uint64(r.Code), 10)
+	buf = append(buf, " latency_ms="...)
+	buf = strconv.AppendFloat(buf, float64(r.Latency)/float64(time.Millisecond), 'f', -1, 64)
+	buf = append(buf, ",bytes_in="...)
+	buf = strconv.AppendUint(buf, r.BytesIn, 10)
+	buf = append(buf, "i,bytes_out="...)
+	buf = strconv.AppendUint(buf, r.BytesOut, 10)
+	buf = append(buf, "i,failed="...)
+	buf = strconv.AppendBool(buf, r.Failed())
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, r.Timestamp.UnixNano(), 10)
+	return append(buf, '\n')
+}
@@ -0,0 +1,60 @@
+package korra
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUDPSink(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	timestamp := time.Unix(1465839830, 100400200)
+	results := []*Result{
+		{Method: "GET", Path: "/users/12", Code: 200, Latency: 12500 * time.Microsecond, BytesIn: 512, Timestamp: timestamp},
+		{Method: "POST", Path: "/login", Code: 500, Latency: time.Second, Error: "500 Internal Server Error", Timestamp: timestamp},
+	}
+	tests := []struct {
+		newSink func(string) (*UDPSink, error)
+		want    []string
+	}{
+		{NewStatsDSink, []string{
+			"korra.requests:1|c|#session:my session,method:GET,bucket:/users/*,status:200\n",
+			"korra.latency:12.5|ms|#session:my session,method:GET,bucket:/users/*,status:200\n",
+			"korra.failures:1|c|#session:my session,method:POST,bucket:/login,status:500\n",
+		}},
+		{NewInfluxSink, []string{
+			`korra_result,session=my\ session,method=GET,bucket=/users/*,status=200 latency_ms=12.5,bytes_in=512i,bytes_out=0i,failed=false 1465839830100400200` + "\n",
+			`korra_result,session=my\ session,method=POST,bucket=/login,status=500 latency_ms=1000,bytes_in=0i,bytes_out=0i,failed=true 1465839830100400200` + "\n",
+		}},
+	}
+	for _, test := range tests {
+		sink, err := test.newSink(server.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			sink.Observe("my session", result)
+		}
+		if err = sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, sinkPacketSize)
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet := string(buf[:n])
+		for _, line := range test.want {
+			if !strings.Contains(packet, line) {
+				t.Errorf("%s: want packet to include %q, got:\n%s", sink.Format, line, packet)
+			}
+		}
+	}
+}
@@ -83,13 +83,20 @@ type Targeter func() (*Target, error)
 
 // Target is an HTTP request blueprint.
 type Target struct {
-	PauseTime int
-	Comment   string
-	Method    string
-	URL       string
-	BodyPath  string
-	Header    http.Header
-	Poller    *TargetPoller
+	Pause      *ThinkTime
+	Comment    string
+	VarName    string
+	VarValue   string
+	Cookies    string
+	Control    *ScriptControl
+	Method     string
+	URL        string
+	BodyPath   string
+	Header     http.Header
+	Poller     *TargetPoller
+	Extractors []*Extractor
+	Assertions []*Assertion
+	vars       *Variables
 }
 
 func NewTarget() *Target {
@@ -97,16 +104,66 @@ func NewTarget() *Target {
 }
 
 // Body reads the full body specified by the BodyPath and returns a Reader; if
-// there is a blank BodyPath it returns a nil Reader
+// there is a blank BodyPath it returns a nil Reader. If the target was
+// created by `Expand` any variable references in the body are resolved.
 func (t *Target) Body() (io.Reader, error) {
 	if t.BodyPath == "" {
 		return nil, nil
 	}
-	if bodyBytes, err := ioutil.ReadFile(t.BodyPath); err != nil {
+	bodyBytes, err := ioutil.ReadFile(t.BodyPath)
+	if err != nil {
 		return nil, err
-	} else {
-		return bytes.NewReader(bodyBytes), nil
 	}
+	if t.vars != nil {
+		expanded, err := t.vars.Expand(string(bodyBytes))
+		if err != nil {
+			return nil, fmt.Errorf("%s in %s", err, t.BodyPath)
+		}
+		bodyBytes = []byte(expanded)
+	}
+	return bytes.NewReader(bodyBytes), nil
+}
+
+// References returns the names of all variables the target refers to in
+// its URL, header values, body file, SET value and IF condition
+func (t *Target) References() []string {
+	refs := References(t.URL + " " + t.VarValue)
+	if t.Control != nil && t.Control.Condition != nil {
+		refs = append(refs, t.Control.Condition.References()...)
+	}
+	for _, values := range t.Header {
+		for _, value := range values {
+			refs = append(refs, References(value)...)
+		}
+	}
+	if t.BodyPath != "" {
+		if bodyBytes, err := ioutil.ReadFile(t.BodyPath); err == nil {
+			refs = append(refs, References(string(bodyBytes))...)
+		}
+	}
+	return refs
+}
+
+// Expand returns a copy of the target with the variable references in its
+// URL and header values resolved from vars; references in the body are
+// resolved when it's read.
+func (t *Target) Expand(vars *Variables) (*Target, error) {
+	var err error
+	expanded := *t
+	if expanded.URL, err = vars.Expand(t.URL); err != nil {
+		return nil, err
+	}
+	expanded.Header = http.Header{}
+	for key, values := range t.Header {
+		for _, value := range values {
+			if value, err = vars.Expand(value); err != nil {
+				return nil, fmt.Errorf("%s in header %s", err, key)
+			}
+			expanded.Header.Add(key, value)
+		}
+	}
+	expanded.vars = vars
+	return &expanded, nil
 }
 
 func (t *Target) IsComment() bool {
@@ -114,7 +171,30 @@ func (t *Target) IsComment() bool {
 }
 
 func (t *Target) IsPause() bool {
-	return t.PauseTime > 0
+	return t.Pause != nil
+}
+
+// HasStatusAssertion returns true if the target asserts which status codes
+// it expects, rather than treating any 2xx or 3xx code as success
+func (t *Target) HasStatusAssertion() bool {
+	for _, assertion := range t.Assertions {
+		if assertion.IsStatus() {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Target) IsControl() bool {
+	return t.Control != nil
+}
+
+func (t *Target) IsCookies() bool {
+	return t.Cookies != ""
+}
+
+func (t *Target) IsAssignment() bool {
+	return t.VarName != ""
 }
 
 // NewTarget creates a new target from an array of strings representing a single target.
@@ -159,10 +239,16 @@ func (t *Target) Request() (*http.Request, error) {
 }
 
 func (t *Target) String() string {
-	if t.PauseTime > 0 {
-		return fmt.Sprintf("PAUSE %d", t.PauseTime)
+	if t.Pause != nil {
+		return fmt.Sprintf("PAUSE %s", t.Pause)
 	} else if t.Comment != "" {
 		return t.Comment
+	} else if t.VarName != "" {
+		return fmt.Sprintf("SET %s %s", t.VarName, t.VarValue)
+	} else if t.Cookies != "" {
+		return fmt.Sprintf("COOKIES %s", t.Cookies)
+	} else if t.Control != nil {
+		return t.Control.String()
 	} else {
 		return fmt.Sprintf("%s %s", t.Method, t.URL)
 	}
@@ -1,17 +1,12 @@
 package korra
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/rand"
-	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"reflect"
-	"strings"
 	"testing"
 )
 
@@ -22,11 +17,18 @@ func TestTargetRequest(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	bodyf, err := ioutil.TempFile("", "korra-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(bodyf.Name())
+	bodyf.Write(body)
+	bodyf.Close()
 
 	tgt := Target{
-		Method: "GET",
-		URL:    "http://:9999/",
-		Body:   body,
+		Method:   "GET",
+		URL:      "http://:9999/",
+		BodyPath: bodyf.Name(),
 		Header: http.Header{
 			"X-Some-Header":       []string{"1"},
 			"X-Some-Other-Header": []string{"2"},
@@ -34,14 +36,17 @@ func TestTargetRequest(t *testing.T) {
 			"Host":                []string{"lolcathost"},
 		},
 	}
-	req, _ := tgt.Request()
+	req, err := tgt.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	reqBody, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !bytes.Equal(tgt.Body, reqBody) {
+	if !bytes.Equal(body, reqBody) {
 		t.Fatalf("Target body wasn't copied correctly")
 	}
 
@@ -58,155 +63,3 @@ func TestTargetRequest(t *testing.T) {
 		t.Fatalf("Target Host wasnt copied correctly. Want: %s, Got: %s", want, req.Host)
 	}
 }
-
-func TestTargetFromScanner(t *testing.T) {
-	src := []string{
-		"GET /foo/bar\nHeader:Value",
-		"POST /foo/bar/baz\nHeader:Value\n@../CHANGELOG",
-		"POST /buzzer\nHeader:Bees\nHeader-Two:Honey\n@../CHANGELOG",
-		"HEAD /foos",
-	}
-	singleHeader := http.Header{}
-	singleHeader.Add("Header", "Value")
-	doubleHeader := http.Header{}
-	doubleHeader.Add("Header", "Bees")
-	doubleHeader.Add("Header-Two", "Honey")
-	postBody, _ := ioutil.ReadFile("../CHANGELOG")
-
-	var emptyBody []byte
-	var emptyHeaders http.Header
-
-	wants := []*Target{
-		&Target{Method: "GET", URL: "/foo/bar", Header: singleHeader, Body: emptyBody},
-		&Target{Method: "POST", URL: "/foo/bar/baz", Header: singleHeader, Body: postBody},
-		&Target{Method: "POST", URL: "/buzzer", Header: doubleHeader, Body: postBody},
-		&Target{Method: "HEAD", URL: "/foos", Header: http.Header{}, Body: emptyBody},
-	}
-
-	for idx, text := range src {
-		want := wants[idx]
-		scanner := peekingScanner{src: bufio.NewScanner(strings.NewReader(text))}
-		got, err := TargetFromScanner(scanner, emptyBody, emptyHeaders, fmt.Sprintf("Item %d", idx))
-		if err != nil {
-			t.Fatal(err)
-		} else if !reflect.DeepEqual(want, got) {
-			t.Fatalf("want: %#v, got: %#v", want, got)
-		}
-	}
-}
-
-func TestNewEagerTargeter(t *testing.T) {
-	t.Parallel()
-
-	src := []byte("GET http://:6060/\nHEAD http://:6606/")
-	read, err := NewEagerTargeter(bytes.NewReader(src), []byte("body"), nil)
-	if err != nil {
-		t.Fatalf("Couldn't parse valid source: %s", err)
-	}
-	for _, want := range []*Target{
-		&Target{
-			Method: "GET",
-			URL:    "http://:6060/",
-			Body:   []byte("body"),
-			Header: http.Header{},
-		},
-		&Target{
-			Method: "HEAD",
-			URL:    "http://:6606/",
-			Body:   []byte("body"),
-			Header: http.Header{},
-		},
-	} {
-		if got, err := read(); err != nil {
-			t.Fatal(err)
-		} else if !reflect.DeepEqual(want, got) {
-			t.Fatalf("want: %#v, got: %#v", want, got)
-		}
-	}
-}
-
-func TestNewLazyTargeter(t *testing.T) {
-	for want, def := range map[error]string{
-		errors.New("bad target"): "GET",
-		errors.New("bad method"): "SET http://:6060",
-		errors.New("bad URL"):    "GET foobar",
-		errors.New("bad body"): `
-			GET http://:6060
-			@238hhqwjhd8hhw3r.txt`,
-		errors.New("bad header"): `
-		  GET http://:6060
-			Authorization`,
-		errors.New("bad header"): `
-			GET http://:6060
-			Authorization:`,
-		errors.New("bad header"): `
-			GET http://:6060
-			: 1234`,
-	} {
-		src := bytes.NewBufferString(strings.TrimSpace(def))
-		read := NewLazyTargeter(src, []byte{}, http.Header{})
-		if _, got := read(); got == nil || !strings.HasPrefix(got.Error(), want.Error()) {
-			t.Errorf("got: %s, want: %s\n%s", got, want, def)
-		}
-	}
-
-	bodyf, err := ioutil.TempFile("", "korra-")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer bodyf.Close()
-	defer os.Remove(bodyf.Name())
-	bodyf.WriteString("Hello world!")
-
-	targets := fmt.Sprint(`
-		GET http://:6060/
-		X-Header: 1
-		X-Header: 2
-
-		PUT https://:6060/123
-
-		POST http://foobar.org/fnord
-		Authorization: x12345
-		@`, bodyf.Name(),
-	)
-
-	src := bytes.NewBufferString(strings.TrimSpace(targets))
-	read := NewLazyTargeter(src, []byte{}, http.Header{"Content-Type": []string{"text/plain"}})
-	for _, want := range []*Target{
-		&Target{
-			Method: "GET",
-			URL:    "http://:6060/",
-			Body:   []byte{},
-			Header: http.Header{
-				"X-Header":     []string{"1", "2"},
-				"Content-Type": []string{"text/plain"},
-			},
-		},
-		&Target{
-			Method: "PUT",
-			URL:    "https://:6060/123",
-			Body:   []byte{},
-			Header: http.Header{"Content-Type": []string{"text/plain"}},
-		},
-		&Target{
-			Method: "POST",
-			URL:    "http://foobar.org/fnord",
-			Body:   []byte("Hello world!"),
-			Header: http.Header{
-				"Authorization": []string{"x12345"},
-				"Content-Type":  []string{"text/plain"},
-			},
-		},
-	} {
-		if got, err := read(); err != nil {
-			t.Fatal(err)
-		} else if !reflect.DeepEqual(want, got) {
-			t.Fatalf("want: %#v, got: %#v", want, got)
-		}
-	}
-	if got, err := read(); err != ErrNoTargets {
-		t.Fatalf("got: %v, want: %v", err, ErrNoTargets)
-	} else if got != nil {
-		t.Fatalf("got: %v, want: %v", got, nil)
-	}
-}
@@ -0,0 +1,80 @@
+package korra
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+)
+
+// ThinkTime is how long a PAUSE waits, in milliseconds. It can be fixed or
+// drawn at random every time the PAUSE runs, so that many sessions running
+// the same script don't move in lock-step:
+//
+//    PAUSE 5000              exactly 5000 ms
+//    PAUSE 1000-5000         uniformly distributed between 1000 and 5000 ms
+//    PAUSE normal(3000,500)  normally distributed, mean 3000 ms and standard
+//                            deviation 500 ms, never below 0
+//    PAUSE exp(2000)         exponentially distributed, mean 2000 ms
+type ThinkTime struct {
+	Distribution string // fixed, uniform, normal or exp
+	Min          int    // fixed time or the lower bound of the uniform range
+	Max          int    // upper bound of the uniform range
+	Mean         int
+	StdDev       int
+}
+
+var (
+	thinkFixed   = regexp.MustCompile(`^(\d+)$`)
+	thinkRange   = regexp.MustCompile(`^(\d+)\s*-\s*(\d+)$`)
+	thinkNormal  = regexp.MustCompile(`^normal\(\s*(\d+)\s*,\s*(\d+)\s*\)$`)
+	thinkExp     = regexp.MustCompile(`^exp\(\s*(\d+)\s*\)$`)
+	errThinkTime = "Expected PAUSE time as millis, range (1000-5000), normal(mean,stddev) or exp(mean), got '%s'"
+)
+
+func NewThinkTime(spec string) (*ThinkTime, error) {
+	atoi := func(value string) int {
+		num, _ := strconv.Atoi(value) // already matched as digits
+		return num
+	}
+	if matches := thinkFixed.FindStringSubmatch(spec); matches != nil {
+		return &ThinkTime{Distribution: "fixed", Min: atoi(matches[1])}, nil
+	} else if matches = thinkRange.FindStringSubmatch(spec); matches != nil {
+		think := &ThinkTime{Distribution: "uniform", Min: atoi(matches[1]), Max: atoi(matches[2])}
+		if think.Max < think.Min {
+			return nil, fmt.Errorf("Expected PAUSE range from low to high, got '%s'", spec)
+		}
+		return think, nil
+	} else if matches = thinkNormal.FindStringSubmatch(spec); matches != nil {
+		return &ThinkTime{Distribution: "normal", Mean: atoi(matches[1]), StdDev: atoi(matches[2])}, nil
+	} else if matches = thinkExp.FindStringSubmatch(spec); matches != nil {
+		return &ThinkTime{Distribution: "exp", Mean: atoi(matches[1])}, nil
+	}
+	return nil, fmt.Errorf(errThinkTime, spec)
+}
+
+// Millis returns the time to pause, drawn from r for random distributions
+func (t *ThinkTime) Millis(r *rand.Rand) int {
+	switch t.Distribution {
+	case "uniform":
+		return t.Min + r.Intn(t.Max-t.Min+1)
+	case "normal":
+		return int(math.Max(0, r.NormFloat64()*float64(t.StdDev)+float64(t.Mean)))
+	case "exp":
+		return int(r.ExpFloat64() * float64(t.Mean))
+	}
+	return t.Min
+}
+
+func (t *ThinkTime) String() string {
+	switch t.Distribution {
+	case "uniform":
+		return fmt.Sprintf("%d-%d", t.Min, t.Max)
+	case "normal":
+		return fmt.Sprintf("normal(%d,%d)", t.Mean, t.StdDev)
+	case "exp":
+		return fmt.Sprintf("exp(%d)", t.Mean)
+	}
+	return strconv.Itoa(t.Min)
+}
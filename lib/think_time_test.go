@@ -0,0 +1,40 @@
+package korra
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestThinkTime(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for spec, bounds := range map[string][2]float64{
+		"5000":              {5000, 5000},
+		"1000-5000":         {2800, 3200},
+		"normal(3000, 500)": {2900, 3100},
+		"exp(2000)":         {1900, 2100},
+	} {
+		think, err := NewThinkTime(spec)
+		if err != nil {
+			t.Fatalf("%s: %s", spec, err)
+		}
+		total := 0
+		for i := 0; i < 10000; i++ {
+			millis := think.Millis(r)
+			if millis < 0 {
+				t.Fatalf("%s: negative pause %d", spec, millis)
+			}
+			total += millis
+		}
+		if mean := float64(total) / 10000; mean < bounds[0] || mean > bounds[1] {
+			t.Errorf("%s: want mean in %v, got %.1f", spec, bounds, mean)
+		}
+	}
+}
+
+func TestThinkTimeErrors(t *testing.T) {
+	for _, spec := range []string{"", "a-while", "5000-1000", "normal(3000)", "exp(-5)", "1.5"} {
+		if _, err := NewThinkTime(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
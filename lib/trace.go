@@ -0,0 +1,102 @@
+package korra
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseTrace times the phases of a request as it goes -- looking up the
+// host, connecting, the TLS handshake, waiting for the response and reading
+// it -- for the Result. Requests that follow redirects add up the phases of
+// every hop, and only count as reusing a connection if every hop did.
+type phaseTrace struct {
+	lock         sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wrote        time.Time
+	firstByte    time.Time
+	bodyDone     time.Time
+	dns          time.Duration
+	connect      time.Duration
+	tls          time.Duration
+	wait         time.Duration
+	conns        int
+	reused       bool
+}
+
+// clientTrace returns the hooks to record the phases; they can be called
+// from other goroutines, even after the request is done
+func (t *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.start(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.done(&t.dnsStart, &t.dns) },
+		ConnectStart: func(network, addr string) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			if t.connectStart.IsZero() { // dialing several addresses at once
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.done(&t.connectStart, &t.connect)
+			}
+		},
+		TLSHandshakeStart: func() { t.start(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.done(&t.tlsStart, &t.tls) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			t.reused = info.Reused && (t.conns == 0 || t.reused)
+			t.conns += 1
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { t.start(&t.wrote) },
+		GotFirstResponseByte: func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			t.firstByte = time.Now()
+			if !t.wrote.IsZero() {
+				t.wait += t.firstByte.Sub(t.wrote)
+				t.wrote = time.Time{}
+			}
+		},
+	}
+}
+
+func (t *phaseTrace) start(at *time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	*at = time.Now()
+}
+
+// done adds the time since the phase started to its total
+func (t *phaseTrace) done(started *time.Time, total *time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !started.IsZero() {
+		*total += time.Since(*started)
+		*started = time.Time{}
+	}
+}
+
+// readBody marks the response body as read
+func (t *phaseTrace) readBody() {
+	t.start(&t.bodyDone)
+}
+
+// record sets the phases on the result
+func (t *phaseTrace) record(result *Result) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	result.DNS = t.dns
+	result.Connect = t.connect
+	result.TLS = t.tls
+	result.FirstByte = t.wait
+	result.Reused = t.conns > 0 && t.reused
+	if !t.firstByte.IsZero() && t.bodyDone.After(t.firstByte) {
+		result.Transfer = t.bodyDone.Sub(t.firstByte)
+	}
+}
@@ -0,0 +1,44 @@
+package korra
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHitPhases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	atk := NewAttacker()
+	hit := func() *Result {
+		tr := func() (*Target, error) { return &Target{Method: "GET", URL: server.URL}, nil }
+		return atk.Hit(context.Background(), tr, time.Now(), 1, NewVariables(nil))
+	}
+
+	first := hit()
+	if first.Error != "" {
+		t.Fatal(first.Error)
+	}
+	if first.Reused || first.Connect == 0 || first.TLS == 0 {
+		t.Errorf("want first request to connect and shake hands, got %+v", first)
+	}
+	if first.FirstByte < 20*time.Millisecond || first.FirstByte > first.Latency {
+		t.Errorf("want first byte after the server's 20ms, within the %s latency, got %s", first.Latency, first.FirstByte)
+	}
+
+	second := hit()
+	if !second.Reused || second.Connect != 0 || second.TLS != 0 {
+		t.Errorf("want second request to reuse the connection, got %+v", second)
+	}
+
+	m := NewMetrics(Results{first, second})
+	if m.Connections.New != 1 || m.Connections.Reused != 1 || m.Phases.FirstByte < 20*time.Millisecond {
+		t.Errorf("want 1 new and 1 reused connection, with first byte after 20ms, got %+v %+v", m.Connections, m.Phases)
+	}
+}
@@ -0,0 +1,139 @@
+package korra
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Variables holds the named values a session can interpolate into its
+// requests with a ${name} reference. Values are typically captured from
+// earlier responses by EXTRACT directives or assigned with SET; anything
+// not found is looked up in the parent, so a session's variables can fall
+// back to those shared by every session (from a -vars file, say) and then
+// to the environment.
+type Variables struct {
+	env    bool
+	parent *Variables
+	values map[string]string
+}
+
+// NewVariables creates an empty set of variables that falls back to parent
+// (which may be nil) for anything it doesn't define itself.
+func NewVariables(parent *Variables) *Variables {
+	return &Variables{parent: parent, values: make(map[string]string)}
+}
+
+// EnvironmentVariables creates a set of variables that resolves anything
+// not explicitly set from the process environment.
+func EnvironmentVariables() *Variables {
+	vars := NewVariables(nil)
+	vars.env = true
+	return vars
+}
+
+// ReadVariablesFile creates a set of variables from a file with one
+// name=value pair per line, falling back to parent for anything else; blank
+// lines and those starting with '#' are skipped.
+func ReadVariablesFile(filename string, parent *Variables) (*Variables, error) {
+	vars := NewVariables(parent)
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening variables file %s: %s", filename, err)
+	}
+	defer in.Close()
+	lineNumber := 0
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pieces := strings.SplitN(line, "=", 2)
+		name := strings.TrimSpace(pieces[0])
+		if len(pieces) != 2 || !IsVariableName(name) {
+			return nil, fmt.Errorf("%s line %d: expected name=value, got '%s'", filename, lineNumber, line)
+		}
+		vars.Set(name, strings.TrimSpace(pieces[1]))
+	}
+	return vars, scanner.Err()
+}
+
+var (
+	variableName      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+	variableReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.\-]*)\}`)
+)
+
+// IsVariableName returns true if name can be referenced as ${name}
+func IsVariableName(name string) bool {
+	return variableName.MatchString(name)
+}
+
+// HasReferences returns true if the text contains at least one ${name}
+// reference.
+func HasReferences(text string) bool {
+	return variableReference.MatchString(text)
+}
+
+// References returns the names of all variables referenced in the text
+func References(text string) []string {
+	var names []string
+	for _, match := range variableReference.FindAllStringSubmatch(text, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Get returns the value for the given name and whether it was found
+func (v *Variables) Get(name string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	if value, ok := v.values[name]; ok {
+		return value, true
+	}
+	if v.env {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+	}
+	return v.parent.Get(name)
+}
+
+// Copy creates variables with the same values and parent, so they can be
+// changed without affecting these
+func (v *Variables) Copy() *Variables {
+	vars := NewVariables(v.parent)
+	vars.env = v.env
+	for name, value := range v.values {
+		vars.values[name] = value
+	}
+	return vars
+}
+
+func (v *Variables) Set(name, value string) {
+	v.values[name] = value
+}
+
+// Expand replaces every ${name} reference in the text with its value; if
+// any reference cannot be resolved the returned error names the first one.
+func (v *Variables) Expand(text string) (string, error) {
+	var missing string
+	expanded := variableReference.ReplaceAllStringFunc(text, func(ref string) string {
+		name := variableReference.FindStringSubmatch(ref)[1]
+		if value, ok := v.Get(name); ok {
+			return value
+		}
+		if missing == "" {
+			missing = name
+		}
+		return ref
+	})
+	if missing != "" {
+		return text, fmt.Errorf("Unresolved variable ${%s}", missing)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,68 @@
+package korra
+
+import (
+	"os"
+	"testing"
+)
+
+func TestVariablesExpand(t *testing.T) {
+	vars := NewVariables(nil)
+	vars.Set("id", "42")
+	if got, err := vars.Expand("http://foo/things/${id}/edit"); err != nil || got != "http://foo/things/42/edit" {
+		t.Errorf("got: %s, err: %s", got, err)
+	}
+	if _, err := vars.Expand("http://foo/${missing}"); err == nil {
+		t.Errorf("expected error for unresolved reference")
+	}
+}
+
+func TestVariablesFallback(t *testing.T) {
+	os.Setenv("KORRA_TEST_HOST", "env.example.com")
+	defer os.Unsetenv("KORRA_TEST_HOST")
+	globals := NewVariables(EnvironmentVariables())
+	globals.Set("token", "global")
+	vars := NewVariables(globals)
+	vars.Set("id", "42")
+	got, err := vars.Expand("https://${KORRA_TEST_HOST}/things/${id}?token=${token}")
+	if want := "https://env.example.com/things/42?token=global"; err != nil || got != want {
+		t.Errorf("want: %s, got: %s (err: %s)", want, got, err)
+	}
+	vars.Set("token", "session")
+	if got, _ := vars.Expand("${token}"); got != "session" {
+		t.Errorf("want: session, got: %s", got)
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	scriptPath, cleanup := writeScript(t, `SET host http://${HOST}
+POST ${host}/things
+EXTRACT id=$.id
+GET ${host}/things/${id}
+GET ${host}/other/${other}
+IF id=${expected}
+END
+IF missing=1
+END
+IF status~^${pattern}
+END
+`)
+	defer cleanup()
+	script, err := CheckScript(scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals := NewVariables(nil)
+	globals.Set("HOST", "localhost")
+	if got := script.CheckReferences(globals); got != 3 {
+		t.Fatalf("want 3 unresolved, got %d", got)
+	}
+	for idx, want := range map[int]string{
+		3: "Line 5: Unresolved variable ${other}",
+		4: "Line 6: Unresolved variable ${expected}",
+		6: "Line 8: Unresolved variable ${missing}",
+	} {
+		if err := script.Actions[idx].Error; err == nil || err.Error() != want {
+			t.Errorf("want error '%s', got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// statusServer serves the progress of a run as JSON, and metrics for
+// Prometheus to scrape, and lets it be paused, resumed or stopped, over HTTP
+type statusServer struct {
+	active   *int32
+	gate     *korra.Gate
+	log      chan string
+	metrics  *korra.PrometheusMetrics
+	queued   *int32
+	sessions func() []*korra.Session
+	started  time.Time
+	stats    *korra.LiveStats
+	stops    chan string
+}
+
+type runStatus struct {
+	Elapsed    time.Duration                    `json:"elapsed"`
+	Paused     bool                             `json:"paused"`
+	Sessions   int                              `json:"sessions"`
+	Complete   int                              `json:"sessions_complete"`
+	Active     int32                            `json:"sessions_active"`
+	Queued     int32                            `json:"sessions_queued"`
+	Totals     korra.LiveTotals                 `json:"totals"`
+	Throughput map[string]float64               `json:"throughput"`
+	Latencies  map[string]windowLatencies       `json:"latencies"`
+	Progress   map[string]korra.SessionProgress `json:"progress"`
+}
+
+type windowLatencies struct {
+	P50 time.Duration `json:"50th"`
+	P95 time.Duration `json:"95th"`
+	P99 time.Duration `json:"99th"`
+}
+
+// statusWindows are the windows to report throughput and latencies over
+var statusWindows = map[string]time.Duration{"10s": 10 * time.Second, "1m": time.Minute}
+
+// listen starts serving on the address in the background, returning the
+// server to close when the run is done
+func (s *statusServer) listen(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot listen on %s: %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.status)
+	mux.HandleFunc("/metrics", s.prometheus)
+	mux.HandleFunc("/pause", s.control)
+	mux.HandleFunc("/resume", s.control)
+	mux.HandleFunc("/stop", s.control)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	s.log <- fmt.Sprintf("Serving status on http://%s/status", listener.Addr())
+	return server, nil
+}
+
+func (s *statusServer) status(w http.ResponseWriter, r *http.Request) {
+	elapsed := time.Since(s.started)
+	status := runStatus{
+		Elapsed:    elapsed,
+		Paused:     s.gate.Paused(),
+		Active:     atomic.LoadInt32(s.active),
+		Queued:     atomic.LoadInt32(s.queued),
+		Totals:     s.stats.Totals(),
+		Throughput: make(map[string]float64),
+		Latencies:  make(map[string]windowLatencies),
+		Progress:   make(map[string]korra.SessionProgress),
+	}
+	for _, session := range s.sessions() {
+		progress := session.Progress()
+		status.Progress[session.Name] = progress
+		status.Sessions += 1
+		if progress.Complete {
+			status.Complete += 1
+		}
+	}
+	for name, duration := range statusWindows {
+		window := s.stats.Window(duration)
+		status.Throughput[name] = throughput(s.stats, duration, elapsed)
+		status.Latencies[name] = windowLatencies{window.Percentile(50), window.Percentile(95), window.Percentile(99)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// prometheus writes the session gauges, then the metrics from results, in
+// the Prometheus text format
+func (s *statusServer) prometheus(w http.ResponseWriter, r *http.Request) {
+	complete := 0
+	for _, session := range s.sessions() {
+		if session.Finished() {
+			complete += 1
+		}
+	}
+	paused := 0
+	if s.gate.Paused() {
+		paused = 1
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeGauge(w, "korra_sessions_active", "Sessions running now.", int(atomic.LoadInt32(s.active)))
+	writeGauge(w, "korra_sessions_queued", "Sessions waiting for a -max-concurrent slot.", int(atomic.LoadInt32(s.queued)))
+	writeGauge(w, "korra_sessions_complete", "Sessions that ran their script to the end.", complete)
+	writeGauge(w, "korra_paused", "1 if the run is paused.", paused)
+	s.metrics.Write(w)
+}
+
+func writeGauge(w io.Writer, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+// control pauses, resumes or stops the run, depending on the path
+func (s *statusServer) control(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Use POST to control the run", http.StatusMethodNotAllowed)
+		return
+	}
+	who := fmt.Sprintf("from %s", r.RemoteAddr)
+	switch r.URL.Path {
+	case "/pause":
+		s.gate.Pause()
+		s.log <- fmt.Sprintf("Paused %s", who)
+	case "/resume":
+		s.gate.Resume()
+		s.log <- fmt.Sprintf("Resumed %s", who)
+	case "/stop":
+		select {
+		case s.stops <- fmt.Sprintf("Stopped %s", who):
+		default: // already stopping
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
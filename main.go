@@ -11,6 +11,7 @@ import (
 func main() {
 	commands := map[string]command{
 		"dump":     dumpCmd(),
+		"inspect":  inspectCmd(),
 		"report":   reportCmd(),
 		"sessions": sessionsCmd(),
 		"validate": validateCmd(),
@@ -49,6 +50,7 @@ examples:
   korra sessions -dir=path/to/sessions > overall-status.log
   korra report -inputs='path/to/results/12*.bin' -reporter=json > metrics.json
   korra report -inputs='path/to/results' -reporter=text 
+  korra inspect -inputs='path/to/results' -status=5xx
 `
 
 type command struct {
@@ -2,21 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
 	"sort"
-	"strconv"
 	"strings"
-	"time"
 
 	korra "github.com/cwinters/korra/lib"
 )
 
 type reportOpts struct {
 	filters  string
+	groupBy  string
 	inputs   string
 	output   string
 	reporter string
@@ -29,6 +30,7 @@ func reportCmd() command {
 
 	fs := flag.NewFlagSet("korra report", flag.ExitOnError)
 	fs.StringVar(&opts.filters, "filters", "", "One or more space-separated filters to operate on subsets of the inputs")
+	fs.StringVar(&opts.groupBy, "group-by", "", "Report separately on each group of results [session, line, step, iteration, branch]")
 	fs.StringVar(&opts.inputs, "inputs", ".", "Input files (comma separated, glob, or dir with .bin files; cwd*)")
 	fs.StringVar(&opts.output, "output", "stdout", "Report output destination (stdout*)")
 	fs.StringVar(&opts.reporter, "reporter", "text", "Reporter [text*, json, plot, dump, hist[buckets]]")
@@ -94,6 +96,9 @@ func report(opts *reportOpts) error {
 	if rep, err = chooseReporter(opts); err != nil {
 		return err
 	}
+	if err = checkGrouping(opts.groupBy); err != nil {
+		return err
+	}
 	files := korra.GlobResults(opts.inputs)
 	srcs := make([]io.Reader, len(files))
 	for i, f := range files {
@@ -134,7 +139,12 @@ outer:
 	sort.Sort(results)
 
 	results = filterResults(results, opts.filters)
-	data, err := rep.Report(results)
+	var data []byte
+	if opts.groupBy == "" {
+		data, err = rep.Report(results)
+	} else {
+		data, err = reportGroups(rep, results, opts.groupBy, opts.reporter == "json")
+	}
 	if err != nil {
 		return err
 	}
@@ -142,92 +152,27 @@ outer:
 	return err
 }
 
-func filterResults(results korra.Results, filters string) korra.Results {
-	trimmed := strings.TrimSpace(filters)
-	if trimmed == "" {
-		return results
-	}
-	filterGroup := newFilterGroup(trimmed, results)
-	var filtered korra.Results
-	for _, result := range results {
-		if filterGroup.Matches(result) {
-			filtered = append(filtered, result)
+// reportGroups reports on each group of results in turn, under a heading,
+// or as a JSON object with a report for each group
+func reportGroups(rep korra.Reporter, results korra.Results, by string, asJSON bool) ([]byte, error) {
+	names, groups := groupResults(results, by)
+	var buf bytes.Buffer
+	reports := make(map[string]json.RawMessage)
+	for _, name := range names {
+		data, err := rep.Report(groups[name])
+		if err != nil {
+			return nil, err
 		}
-	}
-	return filtered
-}
-
-type ResultFilterGroup struct {
-	filters []func(*korra.Result) bool
-}
-
-func newFilterGroup(filterSpecs string, results korra.Results) ResultFilterGroup {
-	group := ResultFilterGroup{}
-	for _, filterSpec := range strings.Split(filterSpecs, " ") {
-		pieces := strings.Split(filterSpec, "=")
-		switch pieces[0] {
-		case "Latency":
-			latencyPieces := strings.Split(pieces[1], "-")
-			min, max := 0, 0
-			var err error
-			if latencyPieces[0] == "" {
-				max, err = strconv.Atoi(latencyPieces[1])
-			} else if latencyPieces[1] == "" {
-				min, err = strconv.Atoi(latencyPieces[0])
-			} else {
-				min, err = strconv.Atoi(latencyPieces[0])
-				if err == nil {
-					max, err = strconv.Atoi(latencyPieces[1])
-				}
-			}
-			if err != nil {
-				panic(fmt.Errorf("Bad 'Latency' filter specification [%s]: %s", pieces[1], err))
-			}
-			group.filters = append(group.filters, func(result *korra.Result) bool {
-				resultMillis := int(result.Latency) / 1000
-				return resultMillis >= min && resultMillis <= max
-			})
-		case "Method":
-			group.filters = append(group.filters, func(result *korra.Result) bool {
-				return result.Method == pieces[1]
-			})
-		case "Path":
-			group.filters = append(group.filters, func(result *korra.Result) bool {
-				return strings.Contains(result.Path, pieces[1])
-			})
-		// Examples:
-		//    Time=1m  => Include results from start to 1 minute after start
-		//    Time=-1m  => (same as above)
-		//    Time=+1m => Include results from 1 minute after start to end
-		case "Time":
-			timeSpecText := pieces[1]
-			lookback := true
-			direction := timeSpecText[0:1]
-			if direction == "-" || direction == "+" {
-				lookback = direction == "-"
-				timeSpecText = timeSpecText[1:]
-			}
-			duration, err := time.ParseDuration(timeSpecText)
-			if err != nil {
-				panic(fmt.Errorf("Bad 'Time' filter specification [%s]: %s", pieces[1], err))
-			}
-			anchorTime := results[0].Timestamp.Add(duration)
-			group.filters = append(group.filters, func(result *korra.Result) bool {
-				if lookback {
-					return result.Timestamp.Before(anchorTime)
-				}
-				return result.Timestamp.After(anchorTime)
-			})
+		if asJSON {
+			reports[name] = data
+			continue
 		}
+		fmt.Fprintf(&buf, "%s %s: %d results\n", strings.ToUpper(by), name, len(groups[name]))
+		buf.Write(data)
+		buf.WriteString("\n")
 	}
-	return group
-}
-
-func (g *ResultFilterGroup) Matches(result *korra.Result) bool {
-	for _, filter := range g.filters {
-		if !filter(result) {
-			return false
-		}
+	if asJSON {
+		return json.Marshal(reports)
 	}
-	return true
+	return buf.Bytes(), nil
 }
@@ -2,18 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	korra "github.com/cwinters/korra/lib"
@@ -26,16 +33,43 @@ func sessionsCmd() command {
 		laddr:   localAddr{&korra.DefaultLocalAddr},
 	}
 
+	fs.Var(&opts.aborts, "abort", "Stop the run early if this holds, e.g. error-rate>5%/1m, p95>2s/1m or conn-errors>=50 (repeatable)")
+	fs.StringVar(&opts.arrival, "arrival", "constant", "How -arrival-rate sessions arrive: constant or poisson")
+	fs.DurationVar(&opts.arrivalFor, "arrival-duration", 0, "How long new sessions arrive at -arrival-rate")
+	fs.StringVar(&opts.arrivalRate, "arrival-rate", "", "Start new sessions at this rate (e.g. 5/s, 300/m), drawing from the scripts at random, instead of running each once")
+	fs.BoolVar(&opts.captureFailures, "capture-failures", false, "Save failed requests and their responses to a .capture file next to each session's results")
+	fs.IntVar(&opts.captureKB, "capture-kb", 4, "KB of each request and response body to save with -capture-failures or -capture-sample, 0 for just headers")
+	fs.Float64Var(&opts.captureSample, "capture-sample", 0, "Save this fraction (0-1) of all requests and their responses, as with -capture-failures")
 	fs.StringVar(&opts.certf, "cert", "", "x509 Certificate file")
-	fs.StringVar(&opts.sessiond, "dir", ".", "Directory of sessions")
+	fs.StringVar(&opts.cookief, "cookie-file", "", "Cookies (Netscape format) to seed every session's cookie jar, turns on -cookies")
+	fs.BoolVar(&opts.cookies, "cookies", false, "Give every session its own cookie jar")
+	fs.StringVar(&opts.dataf, "data", "", "CSV or JSONL file with a row of variables for each session run from -template")
+	fs.StringVar(&opts.sessiond, "dir", ".", "Directory of sessions, or where to write results with -template")
+	fs.DurationVar(&opts.duration, "duration", 0, "Keep running each session's script for this long, stopping it mid-script if need be")
+	fs.DurationVar(&opts.drain, "drain", 10*time.Second, "On interrupt, how long to wait for requests in flight before cancelling them")
 	fs.Var(&opts.headers, "header", "Request header")
+	fs.IntVar(&opts.iterations, "iterations", 0, "Times to run each session's script (default 1, or no limit with -duration)")
 	fs.BoolVar(&opts.keepalive, "keepalive", true, "Use persistent connections")
 	fs.Var(&opts.laddr, "laddr", "Local IP address")
+	fs.StringVar(&opts.listen, "listen", "", "Serve live status as JSON, Prometheus metrics, and pause/resume/stop controls over HTTP on this address (e.g. :8089)")
+	fs.StringVar(&opts.influx, "influx", "", "Send every result to this host:port over UDP, in InfluxDB line protocol")
 	fs.StringVar(&opts.logf, "log", "stdout", "Overall log")
+	fs.Float64Var(&opts.maxRPS, "max-rps", 0, "Cap the combined rate of requests from every session, in requests per second")
+	fs.BoolVar(&opts.maxRPSPerHost, "max-rps-per-host", false, "Apply -max-rps to each host separately")
+	fs.Int64Var(&opts.maxBody, "max-body", 0, "Read at most this many bytes of each response body (default all of it)")
+	fs.IntVar(&opts.maxConcurrent, "max-concurrent", 0, "Run at most this many sessions at once, queueing the rest (default no limit)")
+	fs.StringVar(&opts.nameColumn, "name-column", "", "Column of -data naming each session and its results (default template name and row number)")
+	fs.Float64Var(&opts.pauseScale, "pause-scale", 1, "Multiply every PAUSE by this factor, e.g. 0.1 for a quick smoke run")
 	fs.BoolVar(&opts.pretend, "pretend", false, "Do everything but send traffic")
+	fs.StringVar(&opts.ramp, "ramp", "", "Start sessions gradually: over a duration (5m), in batches (100/30s) or by stages, inline or in a file (0s:100,2m:1000)")
 	fs.IntVar(&opts.redirects, "redirects", korra.DefaultRedirects, "Number of redirects to follow. -1 will not follow but marks as success")
-	fs.IntVar(&opts.statusSec, "status", 30, "Interval to log overall status, in seconds")
-	fs.DurationVar(&opts.timeout, "timeout", korra.DefaultTimeout, "Requests timeout")
+	fs.Int64Var(&opts.seed, "seed", 0, "Seed for random choices in sessions, logged at startup so a run can be reproduced (default based on time)")
+	fs.StringVar(&opts.statsd, "statsd", "", "Send every result to this host:port over UDP, as StatsD metrics")
+	fs.IntVar(&opts.statusSec, "status", 30, "Interval to log overall status, in seconds (0 for never)")
+	fs.StringVar(&opts.templatef, "template", "", "Script to run once for every row of -data, instead of the scripts in -dir")
+	fs.DurationVar(&opts.timeout, "timeout", korra.DefaultTimeout, "Requests timeout, including reading the response body")
+	fs.BoolVar(&opts.ui, "ui", false, "Show a live dashboard of the run in the terminal instead of the log")
+	fs.StringVar(&opts.varsf, "vars", "", "File of name=value variables available to every session")
 	fs.BoolVar(&opts.verbose, "verbose", false, "Verbose logging, show progress from every session")
 
 	return command{fs, func(args []string) error {
@@ -45,125 +79,490 @@ func sessionsCmd() command {
 }
 
 var (
-	errBadCert    = errors.New("bad certificate")
-	errMissingDir = errors.New("directory must exist and have at least one .txt file")
-	timeFormat    = "15:04:05.999999"
+	errBadCert      = errors.New("bad certificate")
+	errMissingDir   = errors.New("directory must exist and have at least one .txt file")
+	errNoData       = errors.New("-template needs a -data file with at least one row")
+	errRampArrivals = errors.New("-ramp and -arrival-rate can't be used together")
+	errArrivalFor   = errors.New("-arrival-rate needs an -arrival-duration")
+	errCaptureKB    = errors.New("-capture-kb can't be negative")
+	unsafeName      = regexp.MustCompile(`[^A-Za-z0-9_.@\-]+`)
+	timeFormat      = "15:04:05.999999"
 )
 
 // sessionOpts aggregates the session function command options
 type sessionsOpts struct {
-	certf     string
-	headers   headers
-	keepalive bool
-	laddr     localAddr
-	logf      string
-	pretend   bool
-	redirects int
-	sessiond  string
-	statusSec int
-	timeout   time.Duration
-	verbose   bool
+	aborts          abortConditions
+	arrival         string
+	arrivalFor      time.Duration
+	arrivalRate     string
+	captureFailures bool
+	captureKB       int
+	captureSample   float64
+	certf           string
+	cookief         string
+	cookies         bool
+	dataf           string
+	drain           time.Duration
+	duration        time.Duration
+	headers         headers
+	influx          string
+	iterations      int
+	keepalive       bool
+	laddr           localAddr
+	listen          string
+	logf            string
+	maxBody         int64
+	maxConcurrent   int
+	maxRPS          float64
+	maxRPSPerHost   bool
+	nameColumn      string
+	pauseScale      float64
+	pretend         bool
+	ramp            string
+	redirects       int
+	seed            int64
+	sessiond        string
+	statsd          string
+	statusSec       int
+	templatef       string
+	timeout         time.Duration
+	ui              bool
+	varsf           string
+	verbose         bool
 }
 
 // sessions validates the arguments, reads in the session scripts and launches
-// them, providing a channel for each so it can halt them at will; it also
-// provides a logger to display overall progress (starting and stopping, plus
-// errors) and also writes to the logger every 30 seconds with the progress.
+// them, stopping them all on an interrupt; it also provides a logger to
+// display overall progress (starting and stopping, plus errors) and also
+// writes to the logger every 30 seconds with the progress. Once every
+// session is done, and its results file closed, it logs a summary.
 func Sessions(opts *sessionsOpts) error {
 	var (
+		arrivals *korra.Arrivals
 		err      error
+		ramp     *korra.Ramp
 		sessions []*korra.Session
 		tlsc     *tls.Config
+		ui       *dashboard
 	)
-	log := os.Stdout
+	var log io.Writer = os.Stdout
+	if opts.ui {
+		ui = &dashboard{out: os.Stdout}
+		log = ui
+	}
 	logChan := make(chan string)
+	logged := make(chan struct{})
 	go func(o chan string) {
-		for {
-			select {
-			case msg := <-o:
-				out := fmt.Sprintf("%s %s\n", time.Now().Format(timeFormat), msg)
-				log.Write([]byte(out))
-			}
+		for msg := range o {
+			out := fmt.Sprintf("%s %s\n", time.Now().Format(timeFormat), msg)
+			log.Write([]byte(out))
 		}
+		close(logged)
 	}(logChan)
+	defer func() {
+		close(logChan)
+		<-logged
+	}()
 
 	if tlsc, err = setupTLS(opts.certf); err != nil {
 		return err
 	}
+	if opts.captureKB < 0 {
+		return errCaptureKB
+	}
+	if opts.ramp != "" {
+		if ramp, err = korra.NewRamp(opts.ramp); err != nil {
+			return err
+		}
+	}
+	if opts.arrivalRate != "" {
+		if arrivals, err = korra.NewArrivals(opts.arrivalRate, opts.arrival); err != nil {
+			return err
+		} else if ramp != nil {
+			return errRampArrivals
+		} else if opts.arrivalFor <= 0 {
+			return errArrivalFor
+		}
+	}
 	clientOptions := []func(*korra.Attacker){
 		korra.Redirects(opts.redirects),
 		korra.Timeout(opts.timeout),
 		korra.LocalAddr(*opts.laddr.IPAddr),
 		korra.TLSConfig(tlsc),
 		korra.KeepAlive(opts.keepalive),
+		korra.Cookies(opts.cookies),
+		korra.MaxBody(opts.maxBody),
+	}
+	if opts.cookief != "" {
+		seeds, err := korra.ReadCookieFile(opts.cookief)
+		if err != nil {
+			return err
+		}
+		clientOptions = append(clientOptions, korra.SeedCookies(seeds))
+	}
+	if opts.maxRPS != 0 {
+		limiter, err := korra.NewRateLimiter(opts.maxRPS, opts.maxRPSPerHost)
+		if err != nil {
+			return err
+		}
+		logChan <- fmt.Sprintf("Limiting to %s", limiter)
+		clientOptions = append(clientOptions, korra.RateLimit(limiter))
 	}
 
 	startTime := time.Now()
+	if opts.seed == 0 {
+		opts.seed = startTime.UnixNano()
+	}
+	logChan <- fmt.Sprintf("Random seed: %d", opts.seed)
 
-	sessionFiles := korra.GlobInputs(fmt.Sprintf("%s/*.txt", opts.sessiond))
-	if sessions, err = readSessions(opts, sessionFiles, clientOptions, logChan); err != nil {
+	if opts.templatef != "" {
+		sessions, err = readTemplateSessions(opts, clientOptions, logChan)
+	} else {
+		sessionFiles := korra.GlobInputs(fmt.Sprintf("%s/*.txt", opts.sessiond))
+		sessions, err = readSessions(opts, sessionFiles, clientOptions, logChan)
+	}
+	if err != nil {
 		return err
 	}
+	if opts.iterations == 0 && opts.duration == 0 {
+		opts.iterations = 1
+	}
+	var (
+		stats   *korra.LiveStats
+		gate    *korra.Gate
+		metrics *korra.PrometheusMetrics
+	)
+	if len(opts.aborts) > 0 || opts.listen != "" || ui != nil {
+		retain := opts.aborts.window()
+		if (opts.listen != "" || ui != nil) && retain < time.Minute {
+			retain = time.Minute // longest window reported by the status server and dashboard
+		}
+		stats = korra.NewLiveStats(retain)
+	}
+	if len(opts.aborts) > 0 {
+		logChan <- fmt.Sprintf("Will abort if %s", opts.aborts)
+	}
+	if opts.listen != "" || ui != nil {
+		gate = korra.NewGate()
+	}
+	if opts.listen != "" {
+		metrics = korra.NewPrometheusMetrics()
+	}
+	var capture *korra.CapturePolicy
+	if opts.captureFailures || opts.captureSample > 0 {
+		capture = &korra.CapturePolicy{Failures: opts.captureFailures, Sample: opts.captureSample, MaxBody: opts.captureKB * 1024}
+	}
+	var sinks []*korra.UDPSink
+	if opts.statsd != "" {
+		sink, err := korra.NewStatsDSink(opts.statsd)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if opts.influx != "" {
+		sink, err := korra.NewInfluxSink(opts.influx)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	for _, sink := range sinks {
+		logChan <- fmt.Sprintf("Sending results to %s", sink)
+	}
+	for _, session := range sessions {
+		session.Iterations = opts.iterations
+		session.Duration = opts.duration
+		session.Gate = gate
+		session.Capture = capture
+		if stats != nil {
+			session.Observers = append(session.Observers, stats)
+		}
+		if metrics != nil {
+			session.Observers = append(session.Observers, metrics)
+		}
+		for _, sink := range sinks {
+			session.Observers = append(session.Observers, sink)
+		}
+	}
 
-	var wg sync.WaitGroup
-	for _, aSession := range sessions {
-		wg.Add(1)
-		go func(session *korra.Session) {
-			defer wg.Done()
-			session.Run(logChan)
-		}(aSession)
+	if ramp != nil {
+		logChan <- fmt.Sprintf("Ramping up %d sessions: %s", len(sessions), ramp)
+	}
+	// cancelling ctx aborts requests in flight
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+	starter := &launcher{ctx: ctx, log: logChan, quit: make(chan struct{}), running: sessions}
+	if opts.maxConcurrent > 0 {
+		logChan <- fmt.Sprintf("Running at most %d sessions at once", opts.maxConcurrent)
+		starter.slots = &sessionQueue{free: opts.maxConcurrent}
+	}
+	stops := make(chan string, 1)
+	if opts.listen != "" {
+		server := &statusServer{
+			active:   &starter.active,
+			gate:     gate,
+			log:      logChan,
+			metrics:  metrics,
+			queued:   &starter.queued,
+			sessions: starter.current,
+			started:  startTime,
+			stats:    stats,
+			stops:    stops,
+		}
+		httpServer, err := server.listen(opts.listen)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			// wait for handlers, which log, before the log is closed
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdown)
+		}()
+	}
+	if ui != nil {
+		ui.active, ui.queued, ui.gate, ui.stats, ui.stops = &starter.active, &starter.queued, gate, stats, stops
+		ui.sessions, ui.started = starter.current, startTime
+		if err := ui.start(); err != nil {
+			return err
+		}
+		defer ui.stop()
+	}
+	if arrivals != nil {
+		// open model: new instances of the scripts arrive until time is up
+		logChan <- fmt.Sprintf("Starting sessions from %d scripts for %s: %s", len(sessions), opts.arrivalFor, arrivals)
+		starter.running = nil
+		starter.arrive(sessions, arrivals, opts.arrivalFor, opts.seed)
+	} else {
+		for idx, session := range sessions {
+			starter.launch(session, ramp.Offset(idx, len(sessions)))
+		}
 	}
 
-	// catch completion of all sessions, and from the OS
-	var done = make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt)
+	// catch completion of all sessions, and interrupts from the OS
+	finished := make(chan struct{})
 	go func() {
-		wg.Wait()
-		done <- os.Interrupt
+		starter.wg.Wait()
+		close(finished)
 	}()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+	aborts := make(chan string, 1)
+	if stats != nil {
+		go watchAborts(opts.aborts, stats, aborts, finished)
+	}
 
-	for {
+	// stop every session, giving requests in flight time to finish
+	var abortReason string
+	stopAll := func(why string) {
+		starter.stop()
+		logChan <- fmt.Sprintf("%s, waiting up to %s for requests in flight (interrupt again to cancel them now)", why, opts.drain)
+		drain := time.NewTimer(opts.drain)
 		select {
-		case <-done:
-			for _, session := range sessions {
-				session.Stop() // wait for each session to finish up?
+		case <-finished:
+		case <-drain.C:
+			logChan <- "Cancelling requests in flight"
+		case <-interrupts:
+			logChan <- "Cancelling requests in flight"
+		}
+		drain.Stop()
+		abort()
+		<-finished
+	}
+
+	var statusTicks <-chan time.Time // never ticks if status isn't logged
+	if opts.statusSec > 0 {
+		status := time.NewTicker(time.Duration(opts.statusSec) * time.Second)
+		defer status.Stop()
+		statusTicks = status.C
+	}
+	for waiting := true; waiting; {
+		select {
+		case <-finished:
+			waiting = false
+		case <-interrupts:
+			stopAll("Interrupted")
+			waiting = false
+		case abortReason = <-aborts:
+			stopAll(fmt.Sprintf("Aborting: %s", abortReason))
+			waiting = false
+		case why := <-stops:
+			stopAll(why)
+			waiting = false
+		case <-statusTicks:
+			if ui != nil {
+				continue // the dashboard shows it all
 			}
-			return nil
-		case <-time.After(time.Duration(opts.statusSec) * time.Second):
-			actionCount, actionsDone, sessionsDone := 0, 0, 0
-			for _, session := range sessions {
-				progress := session.Progress()
-				actionCount += progress.Actions
-				actionsDone += progress.Current
-				if progress.Complete {
-					sessionsDone += 1
-				}
+			line := progressStatus(startTime, starter.current(), atomic.LoadInt32(&starter.active), atomic.LoadInt32(&starter.queued), starter.slots != nil)
+			if gate != nil && gate.Paused() {
+				line += " (paused)"
 			}
-			sessionCount := len(sessions)
-			logChan <- fmt.Sprintf("Elapsed %s: %d/%d actions complete (%.2f%%); %d/%d sessions complete (%.2f%%)",
-				time.Since(startTime),
-				actionsDone, actionCount, (float32(actionsDone)/float32(actionCount))*100,
-				sessionsDone, sessionCount, (float32(sessionsDone)/float32(sessionCount))*100)
+			logChan <- line
 		}
 	}
+
+	if ui != nil {
+		ui.stop()
+	}
+
+	// every session that started has closed its results file by now
+	for _, sink := range sinks {
+		sink.Close()
+		if dropped := sink.Dropped(); dropped > 0 {
+			logChan <- fmt.Sprintf("Dropped %d results that couldn't be sent to %s in time", dropped, sink)
+		}
+	}
+	running, started := starter.current(), int(starter.started)
+	complete, written, captured := 0, 0, 0
+	for _, session := range running {
+		if session.Finished() {
+			complete += 1
+		}
+		written += session.ResultCount()
+		captured += session.CaptureCount()
+	}
+	if capture != nil {
+		logChan <- fmt.Sprintf("Captured %d requests, see them with 'korra inspect -inputs %s'", captured, opts.sessiond)
+	}
+	logChan <- fmt.Sprintf("Finished in %s: %d sessions complete, %d stopped early, %d never started; %d results written to %d files",
+		time.Since(startTime), complete, started-complete, len(running)-started, written, started)
+	if starter.runErrors > 0 {
+		return fmt.Errorf("%d sessions could not write their results", starter.runErrors)
+	} else if abortReason != "" {
+		return fmt.Errorf("Aborted: %s", abortReason)
+	}
 	return nil
 }
 
+// watchAborts checks the abort conditions against the stats every second
+// until one holds, sending why on aborts, or the run is finished
+func watchAborts(conditions abortConditions, stats *korra.LiveStats, aborts chan string, finished chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			for _, condition := range conditions {
+				if reason := condition.Check(stats); reason != "" {
+					aborts <- reason
+					return
+				}
+			}
+		}
+	}
+}
+
+// progressStatus describes how far along the sessions are, for logging
+// periodically
+func progressStatus(startTime time.Time, sessions []*korra.Session, active, queued int32, queueing bool) string {
+	actionCount, actionsDone, sessionsDone := 0, 0, 0
+	for _, session := range sessions {
+		progress := session.Progress()
+		actionCount += progress.Actions
+		actionsDone += progress.Current
+		if progress.Complete {
+			sessionsDone += 1
+		}
+	}
+	sessionCount := len(sessions)
+	status := fmt.Sprintf("Elapsed %s: %d/%d actions complete (%.2f%%); %d/%d sessions complete (%.2f%%); %d active",
+		time.Since(startTime),
+		actionsDone, actionCount, fraction(actionsDone, actionCount)*100,
+		sessionsDone, sessionCount, fraction(sessionsDone, sessionCount)*100,
+		active)
+	if queueing {
+		status += fmt.Sprintf(", %d queued", queued)
+	}
+	return status
+}
+
 func readSessions(opts *sessionsOpts, sessionFiles []string, clientOptions []func(*korra.Attacker), log chan string) ([]*korra.Session, error) {
 	var err error
 	sessions := make([]*korra.Session, len(sessionFiles))
 	if len(sessionFiles) == 0 {
 		return sessions, errMissingDir
 	}
+	globals, err := readVariables(opts.varsf)
+	if err != nil {
+		return sessions, err
+	}
 	for idx, sessionFile := range sessionFiles {
 		if sessions[idx], err = korra.NewSession(sessionFile, clientOptions, log, opts.verbose); err != nil {
 			return sessions, fmt.Errorf("Error creating session script %s: %s", sessionFile, err)
 		}
 		sessions[idx].Pretend = opts.pretend
+		sessions[idx].Seed = opts.seed
+		sessions[idx].PauseScale = opts.pauseScale
+		sessions[idx].Vars = korra.NewVariables(globals)
+	}
+	return sessions, nil
+}
+
+// readTemplateSessions reads the template script once and creates an
+// instance of it for every row of the data file, with the row's columns as
+// session variables. Each is named by the value in its name column, which
+// also names its results file in the sessions directory.
+func readTemplateSessions(opts *sessionsOpts, clientOptions []func(*korra.Attacker), log chan string) ([]*korra.Session, error) {
+	if opts.dataf == "" {
+		return nil, errNoData
+	}
+	rows, err := korra.ReadDataFile(opts.dataf)
+	if err != nil {
+		return nil, err
+	} else if len(rows) == 0 {
+		return nil, errNoData
+	}
+	globals, err := readVariables(opts.varsf)
+	if err != nil {
+		return nil, err
+	}
+	// parse the script once, then every row runs its own instance of it
+	session, err := korra.NewSession(opts.templatef, clientOptions, log, opts.verbose)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating session script %s: %s", opts.templatef, err)
+	}
+	session.Pretend = opts.pretend
+	session.Seed = opts.seed
+	session.PauseScale = opts.pauseScale
+	session.Vars = korra.NewVariables(globals)
+	template := strings.TrimSuffix(filepath.Base(opts.templatef), ".txt")
+	sessions := make([]*korra.Session, len(rows))
+	names := make(map[string]int)
+	for idx, row := range rows {
+		name := fmt.Sprintf("%s_%d", template, idx+1)
+		if opts.nameColumn != "" {
+			if name = row[opts.nameColumn]; name == "" {
+				return nil, fmt.Errorf("Row %d of %s has no value for name column '%s'", idx+1, opts.dataf, opts.nameColumn)
+			}
+		}
+		fileName := unsafeName.ReplaceAllString(name, "_")
+		if prior, ok := names[fileName]; ok {
+			return nil, fmt.Errorf("Rows %d and %d of %s would both write results to %s.bin", prior, idx+1, opts.dataf, fileName)
+		}
+		names[fileName] = idx + 1
+		sessions[idx] = session.Instance(idx + 1)
+		sessions[idx].Name = name
+		sessions[idx].Output = filepath.Join(opts.sessiond, fileName+".bin")
+		for column, value := range row {
+			sessions[idx].Vars.Set(column, value)
+		}
 	}
 	return sessions, nil
 }
 
+// readVariables returns the variables shared by all sessions: those from the
+// given file (if any) backed by the environment
+func readVariables(filename string) (*korra.Variables, error) {
+	if filename == "" {
+		return korra.EnvironmentVariables(), nil
+	}
+	return korra.ReadVariablesFile(filename, korra.EnvironmentVariables())
+}
+
 // headers is the http.Header used in each target request
 // it is defined here to implement the flag.Value interface
 // in order to support multiple identical flags for request header
@@ -191,6 +590,38 @@ func (h headers) Set(value string) error {
 	return nil
 }
 
+// abortConditions implements the flag.Value interface to collect every
+// -abort condition
+type abortConditions []*korra.AbortCondition
+
+func (a abortConditions) String() string {
+	conditions := make([]string, len(a))
+	for idx, condition := range a {
+		conditions[idx] = condition.String()
+	}
+	return strings.Join(conditions, " or ")
+}
+
+func (a *abortConditions) Set(value string) error {
+	condition, err := korra.NewAbortCondition(value)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, condition)
+	return nil
+}
+
+// window returns the longest window of any condition
+func (a abortConditions) window() time.Duration {
+	var longest time.Duration
+	for _, condition := range a {
+		if condition.Window > longest {
+			longest = condition.Window
+		}
+	}
+	return longest
+}
+
 // localAddr implements the Flag interface for parsing net.IPAddr
 type localAddr struct{ *net.IPAddr }
 
@@ -226,3 +657,165 @@ func certPool(cert []byte) (*x509.CertPool, error) {
 	}
 	return pool, nil
 }
+
+// launcher starts sessions running, each in its own goroutine once its
+// delay is up and, if they're queued, a slot is free, until quit closes
+type launcher struct {
+	ctx       context.Context // cancelled to abort requests in flight
+	log       chan string
+	quit      chan struct{} // closed to stop sessions from starting
+	slots     *sessionQueue // nil to start every session as soon as it's due
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	running   []*korra.Session // every session started or due to start
+	stopping  bool             // set by stop, after which no session starts
+	active    int32
+	queued    int32
+	started   int32
+	runErrors int32
+}
+
+// launch starts the session once the delay is up, or never if quit closes
+// first; only then does it open its results file
+func (l *launcher) launch(session *korra.Session, delay time.Duration) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		select {
+		case <-l.quit:
+			return
+		case <-time.After(delay):
+		}
+		if l.slots != nil {
+			// wait in line for a slot, which the session frees when done
+			atomic.AddInt32(&l.queued, 1)
+			ok := l.slots.acquire(l.quit)
+			atomic.AddInt32(&l.queued, -1)
+			if !ok {
+				return
+			}
+			defer l.slots.release()
+		}
+		// checked under mu so that once stop returns no more sessions
+		// start, and every one that has was told to stop
+		l.mu.Lock()
+		if l.stopping {
+			l.mu.Unlock()
+			return
+		}
+		atomic.AddInt32(&l.started, 1)
+		atomic.AddInt32(&l.active, 1)
+		l.mu.Unlock()
+		defer atomic.AddInt32(&l.active, -1)
+		if err := session.Run(l.ctx); err != nil {
+			atomic.AddInt32(&l.runErrors, 1)
+			l.log <- fmt.Sprintf("%s: %s", session.Name, err)
+		}
+	}()
+}
+
+// arrive starts new instances of the scripts, drawn at random, at the
+// arrival rate until time is up or quit closes
+func (l *launcher) arrive(scripts []*korra.Session, arrivals *korra.Arrivals, duration time.Duration, seed int64) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		random := rand.New(rand.NewSource(seed))
+		deadline := time.After(duration)
+		next := time.Now()
+		for number := 1; ; number++ {
+			next = next.Add(arrivals.Gap(random))
+			select {
+			case <-l.quit:
+				return
+			case <-deadline:
+				l.log <- fmt.Sprintf("Arrivals done, started %d sessions", number-1)
+				return
+			case <-time.After(time.Until(next)):
+			}
+			session := scripts[random.Intn(len(scripts))].Instance(number)
+			l.mu.Lock()
+			if l.stopping {
+				// stop has already told every running session to stop, so
+				// this one would be missed
+				l.mu.Unlock()
+				return
+			}
+			l.running = append(l.running, session)
+			l.mu.Unlock()
+			l.launch(session, 0)
+		}
+	}()
+}
+
+// current returns every session started or due to start
+func (l *launcher) current() []*korra.Session {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
+
+// stop keeps any more sessions from starting and asks those running to
+// stop once they finish what they're doing
+func (l *launcher) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopping = true
+	close(l.quit)
+	for _, session := range l.running {
+		session.Stop()
+	}
+}
+
+// sessionQueue lets a limited number of sessions run at once, starting
+// those waiting in the order they joined the queue
+type sessionQueue struct {
+	lock    sync.Mutex
+	free    int
+	waiting []chan struct{}
+}
+
+// acquire waits for a slot, returning false if quit closes first
+func (q *sessionQueue) acquire(quit <-chan struct{}) bool {
+	q.lock.Lock()
+	if q.free > 0 && len(q.waiting) == 0 {
+		q.free -= 1
+		q.lock.Unlock()
+		return true
+	}
+	turn := make(chan struct{})
+	q.waiting = append(q.waiting, turn)
+	q.lock.Unlock()
+
+	select {
+	case <-turn:
+		return true
+	case <-quit:
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for idx, waiting := range q.waiting {
+		if waiting == turn {
+			q.waiting = append(q.waiting[:idx], q.waiting[idx+1:]...)
+			return false
+		}
+	}
+	q.releaseLocked() // given a slot just as quit closed, so pass it on
+	return false
+}
+
+// release frees a slot for the next session waiting, if any
+func (q *sessionQueue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.releaseLocked()
+}
+
+func (q *sessionQueue) releaseLocked() {
+	if len(q.waiting) > 0 {
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+	} else {
+		q.free += 1
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+func TestSessionQueueOrder(t *testing.T) {
+	for _, free := range []int{1, 2, 3} {
+		q := &sessionQueue{free: free}
+		for i := 0; i < free; i++ {
+			if !q.acquire(nil) {
+				t.Fatalf("%d slots: want a free slot", free)
+			}
+		}
+		started := make(chan int, 5)
+		for i := 0; i < 5; i++ {
+			go func(i int) {
+				if q.acquire(nil) {
+					started <- i
+				}
+			}(i)
+			waitFor(t, func() bool { return waitingIn(q) == i+1 })
+		}
+		for want := 0; want < 5; want++ {
+			q.release()
+			select {
+			case got := <-started:
+				if got != want {
+					t.Errorf("%d slots: want session %d to start next, got %d", free, want, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%d slots: session %d never started", free, want)
+			}
+		}
+	}
+}
+
+func TestSessionQueueQuit(t *testing.T) {
+	for name, closeFirst := range map[string]bool{
+		"quit while waiting": false,
+		"already quit":       true,
+	} {
+		q := &sessionQueue{free: 1}
+		q.acquire(nil)
+		quit := make(chan struct{})
+		if closeFirst {
+			close(quit)
+		}
+		acquired := make(chan bool)
+		go func() { acquired <- q.acquire(quit) }()
+		if !closeFirst {
+			waitFor(t, func() bool { return waitingIn(q) == 1 })
+			close(quit)
+		}
+		select {
+		case ok := <-acquired:
+			if ok {
+				t.Errorf("%s: want no slot once quit", name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: still waiting after quit", name)
+		}
+		q.release()
+		if waitingIn(q) != 0 || q.free != 1 {
+			t.Errorf("%s: want the slot back and nobody waiting, got %d free and %d waiting", name, q.free, waitingIn(q))
+		}
+	}
+}
+
+func TestLaunchOpensResultsOnStart(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	starter := testLauncher(1)
+	first, second := idleSession(t, dir, "first", 200), idleSession(t, dir, "second", 200)
+	starter.launch(first, 0)
+	waitFor(t, func() bool { return atomic.LoadInt32(&starter.active) == 1 })
+	starter.launch(second, 0)
+	waitFor(t, func() bool { return atomic.LoadInt32(&starter.queued) == 1 })
+	if !exists(first.Output) || exists(second.Output) {
+		t.Errorf("want only the running session's results file, got first %t and second %t", exists(first.Output), exists(second.Output))
+	}
+	starter.wg.Wait()
+	if !exists(second.Output) {
+		t.Error("want results file once the queued session started")
+	}
+
+	// one that never gets a slot never writes a file
+	starter = testLauncher(0)
+	never := idleSession(t, dir, "never", 200)
+	starter.running = []*korra.Session{never}
+	starter.launch(never, 0)
+	waitFor(t, func() bool { return atomic.LoadInt32(&starter.queued) == 1 })
+	starter.stop()
+	starter.wg.Wait()
+	if exists(never.Output) || starter.started != 0 {
+		t.Errorf("want no results file for a session stopped while queued, started %d", starter.started)
+	}
+}
+
+func TestLaunchStopDuringArrivals(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	arrivals, err := korra.NewArrivals("200/s", "constant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	starter := testLauncher(0)
+	starter.slots = nil
+	starter.arrive([]*korra.Session{idleSession(t, dir, "idle", 10000)}, arrivals, time.Minute, 1)
+	waitFor(t, func() bool { return atomic.LoadInt32(&starter.started) >= 5 })
+	starter.stop()
+	started := atomic.LoadInt32(&starter.started)
+
+	// a session missed by stop would pause for the full 10s
+	finished := make(chan struct{})
+	go func() {
+		starter.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sessions still running after stop")
+	}
+	if after := atomic.LoadInt32(&starter.started); after != started {
+		t.Errorf("want no sessions started after stop, but %d were", after-started)
+	}
+	for _, session := range starter.current() {
+		if session.Finished() {
+			t.Errorf("want %s stopped early, but it finished", session.Name)
+		}
+	}
+}
+
+func testLauncher(slots int) *launcher {
+	log := make(chan string, 100)
+	return &launcher{ctx: context.Background(), log: log, quit: make(chan struct{}), slots: &sessionQueue{free: slots}}
+}
+
+// idleSession creates a session that just pauses for the given time,
+// writing its results to the directory
+func idleSession(t *testing.T, dir, name string, pauseMillis int) *korra.Session {
+	scriptPath := filepath.Join(dir, name+".txt")
+	script := fmt.Sprintf("PAUSE %d\n", pauseMillis)
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	session, err := korra.NewSession(scriptPath, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Output = filepath.Join(dir, name+".bin")
+	return session
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "korra-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func waitingIn(q *sessionQueue) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.waiting)
+}
+
+// waitFor polls until the condition holds, failing after a second
+func waitFor(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(time.Second); !condition(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+	}
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	korra "github.com/cwinters/korra/lib"
+)
+
+// dashboard draws the state of a run on the terminal every second, and
+// stands in for the log while it does, showing its latest lines at the
+// bottom and holding the rest in a temporary file to write out when done.
+// Keys toggle between the busiest paths and every session's progress,
+// pause and resume, and stop the run.
+type dashboard struct {
+	lock     sync.Mutex
+	out      *os.File
+	running  bool
+	verbose  bool     // show every session instead of errors and paths
+	lines    []string // latest log lines
+	held     *os.File // the whole log while running
+	restore  string   // terminal settings to put back
+	width    int
+	height   int
+	done     chan struct{}
+	active   *int32
+	gate     *korra.Gate
+	queued   *int32
+	sessions func() []*korra.Session
+	started  time.Time
+	stats    *korra.LiveStats
+	stops    chan string
+}
+
+const (
+	dashboardLogLines = 5
+	dashboardTopN     = 5
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Write keeps a log line to show, or writes it out if the dashboard isn't
+// running
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.running {
+		return d.out.Write(p)
+	}
+	d.lines = append(d.lines, strings.TrimRight(string(p), "\n"))
+	if len(d.lines) > dashboardLogLines*10 {
+		d.lines = d.lines[len(d.lines)-dashboardLogLines:]
+	}
+	return d.held.Write(p)
+}
+
+// start takes over the terminal, reading keys as they're pressed, and
+// draws the dashboard every second until stopped
+func (d *dashboard) start() error {
+	saved, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("-ui needs a terminal: %s", err)
+	}
+	if _, err = stty("cbreak", "-echo"); err != nil {
+		return fmt.Errorf("-ui needs a terminal: %s", err)
+	}
+	d.restore = strings.TrimSpace(saved)
+	if d.held, err = ioutil.TempFile("", "korra-log-"); err != nil {
+		stty(d.restore)
+		return fmt.Errorf("Cannot hold the log while the dashboard runs: %s", err)
+	}
+	d.width, d.height = 80, 24
+	if size, err := stty("size"); err == nil {
+		fmt.Sscanf(size, "%d %d", &d.height, &d.width)
+	}
+	d.lock.Lock()
+	d.running = true
+	d.done = make(chan struct{})
+	d.lock.Unlock()
+	d.out.WriteString("\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+
+	// There's no way to interrupt a read from stdin, so once stopped this
+	// goroutine is left blocked in Read until the next key or the end of
+	// input; it just drops that key and goes away rather than waiting on
+	// a dashboard that's no longer listening.
+	keys := make(chan byte)
+	done := d.done
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(buf); err != nil {
+				return
+			} else if n == 1 {
+				select {
+				case keys <- buf[0]:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			d.draw()
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+			case key := <-keys:
+				d.press(key)
+			}
+		}
+	}()
+	return nil
+}
+
+// stop gives the terminal back, after which log lines are written out
+// again; it's safe to call more than once
+func (d *dashboard) stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.running {
+		return
+	}
+	d.running = false
+	close(d.done)
+	d.out.WriteString("\x1b[?25h\x1b[?1049l")
+	stty(d.restore)
+	d.held.Seek(0, io.SeekStart)
+	io.Copy(d.out, d.held)
+	d.held.Close()
+	os.Remove(d.held.Name())
+	d.lines = nil
+}
+
+func (d *dashboard) press(key byte) {
+	switch key {
+	case 'v':
+		d.lock.Lock()
+		d.verbose = !d.verbose
+		d.lock.Unlock()
+	case 'p':
+		if d.gate.Paused() {
+			d.gate.Resume()
+		} else {
+			d.gate.Pause()
+		}
+	case 'q':
+		select {
+		case d.stops <- "Stopped from the dashboard":
+		default: // already stopping
+		}
+	}
+}
+
+func (d *dashboard) draw() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.running {
+		return
+	}
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+	for _, line := range d.render() {
+		if utf8.RuneCountInString(line) > d.width {
+			line = string([]rune(line)[:d.width])
+		}
+		screen.WriteString(line + "\x1b[K\n")
+	}
+	screen.WriteString("\x1b[J")
+	d.out.WriteString(screen.String())
+}
+
+// render returns the lines of the dashboard, fitting the terminal
+func (d *dashboard) render() []string {
+	elapsed := time.Since(d.started)
+	totals := d.stats.Totals()
+	sessions := d.sessions()
+	actionCount, actionsDone, sessionsDone := 0, 0, 0
+	progress := make([]korra.SessionProgress, len(sessions))
+	for idx, session := range sessions {
+		progress[idx] = session.Progress()
+		actionCount += progress[idx].Actions
+		actionsDone += progress[idx].Current
+		if progress[idx].Complete {
+			sessionsDone += 1
+		}
+	}
+
+	state := "running"
+	if d.gate.Paused() {
+		state = "PAUSED"
+	}
+	lines := []string{
+		fmt.Sprintf("korra sessions  %s  %s    [v] sessions  [p] pause/resume  [q] stop", elapsed.Round(time.Second), state),
+		"",
+		fmt.Sprintf("Sessions  %s %d/%d complete, %d active, %d queued", bar(fraction(sessionsDone, len(sessions)), 20),
+			sessionsDone, len(sessions), atomic.LoadInt32(d.active), atomic.LoadInt32(d.queued)),
+		fmt.Sprintf("Actions   %s %d/%d (%.1f%%)", bar(fraction(actionsDone, actionCount), 20),
+			actionsDone, actionCount, 100*fraction(actionsDone, actionCount)),
+	}
+
+	window := d.stats.Window(time.Minute)
+	perSecond := d.stats.PerSecond(clamp(d.width-30, 10, 60))
+	lines = append(lines,
+		fmt.Sprintf("Requests  %d, %d failed (%.2f%%); %.1f/s over the last 10s",
+			totals.Requests, totals.Failures, 100*fraction(totals.Failures, totals.Requests), throughput(d.stats, 10*time.Second, elapsed)),
+		fmt.Sprintf("          %s last %ds, peak %d/s", sparkline(perSecond), len(perSecond), maxOf(perSecond)),
+		fmt.Sprintf("Latency   p50 %s  p95 %s  p99 %s over the last minute",
+			window.Percentile(50).Round(time.Millisecond), window.Percentile(95).Round(time.Millisecond), window.Percentile(99).Round(time.Millisecond)),
+		"Status    "+statusCodes(totals.StatusCodes),
+		"",
+	)
+
+	rows := d.height - len(lines) - dashboardLogLines - 2
+	if d.verbose {
+		lines = append(lines, sessionLines(sessions, progress, rows)...)
+	} else {
+		lines = append(lines, summaryLines(totals, rows)...)
+	}
+
+	lines = append(lines, "", "Log")
+	logLines := d.lines
+	if len(logLines) > dashboardLogLines {
+		logLines = logLines[len(logLines)-dashboardLogLines:]
+	}
+	return append(lines, logLines...)
+}
+
+// sessionLines shows the progress of each session, unfinished ones first
+func sessionLines(sessions []*korra.Session, progress []korra.SessionProgress, rows int) []string {
+	order := make([]int, len(sessions))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return !progress[order[i]].Complete && progress[order[j]].Complete
+	})
+	lines := []string{"Sessions"}
+	shown := len(order)
+	if limit := clamp(rows-1, 2, len(order)); shown > limit {
+		shown = limit - 1 // leave a line to say how many aren't shown
+	}
+	for count, idx := range order {
+		if count == shown {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(order)-count))
+			break
+		}
+		p := progress[idx]
+		lines = append(lines, fmt.Sprintf("  %-30s %s %d/%d", sessions[idx].Name, bar(float64(p.Percentage)/100, 20), p.Current, p.Actions))
+	}
+	return lines
+}
+
+// summaryLines shows the most common errors and slowest paths
+func summaryLines(totals korra.LiveTotals, rows int) []string {
+	topN := clamp((rows-2)/2, 1, dashboardTopN)
+	lines := []string{"Top errors"}
+	messages := make([]string, 0, len(totals.Errors))
+	for message := range totals.Errors {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return totals.Errors[messages[i]] > totals.Errors[messages[j]] })
+	for idx, message := range messages {
+		if idx == topN {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %7d  %s", totals.Errors[message], message))
+	}
+	if len(messages) == 0 {
+		lines = append(lines, "  none")
+	}
+
+	lines = append(lines, "Slowest paths (mean, max, requests, failures)")
+	paths := make([]string, 0, len(totals.Paths))
+	for path := range totals.Paths {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return totals.Paths[paths[i]].Mean() > totals.Paths[paths[j]].Mean() })
+	for idx, path := range paths {
+		if idx == topN {
+			break
+		}
+		p := totals.Paths[path]
+		lines = append(lines, fmt.Sprintf("  %-40s %8s %8s %7d %5d", path,
+			p.Mean().Round(time.Millisecond), p.LatencyMax.Round(time.Millisecond), p.Requests, p.Failures))
+	}
+	return lines
+}
+
+func statusCodes(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	cells := make([]string, len(codes))
+	for idx, code := range codes {
+		cells[idx] = fmt.Sprintf("%d: %d", code, counts[code])
+	}
+	return strings.Join(cells, "   ")
+}
+
+// throughput is the requests per second over the window, or over the run
+// if it's not been going that long
+func throughput(stats *korra.LiveStats, d, elapsed time.Duration) float64 {
+	requests := stats.Window(d).Requests
+	if elapsed < d {
+		d = elapsed
+	}
+	return float64(requests) / d.Seconds()
+}
+
+func bar(fraction float64, width int) string {
+	filled := clamp(int(fraction*float64(width)), 0, width)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+func sparkline(counts []int) string {
+	peak := maxOf(counts)
+	line := make([]rune, len(counts))
+	for idx, count := range counts {
+		line[idx] = ' '
+		if count > 0 {
+			line[idx] = sparks[(count*(len(sparks)-1)+peak-1)/peak]
+		}
+	}
+	return string(line)
+}
+
+func fraction(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+func maxOf(values []int) int {
+	peak := 0
+	for _, value := range values {
+		if value > peak {
+			peak = value
+		}
+	}
+	return peak
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	} else if value > max {
+		return max
+	}
+	return value
+}
+
+// stty runs stty on the terminal with the arguments, returning its output
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -9,26 +9,45 @@ import (
 )
 
 type validateOpts struct {
+	dataf     string
 	validateg string
+	varsf     string
 	verbose   bool
 }
 
 func validateCmd() command {
 	fs := flag.NewFlagSet("korra validate ", flag.ExitOnError)
 	opts := &validateOpts{}
+	fs.StringVar(&opts.dataf, "data", "", "CSV or JSONL file whose columns are variables, as for sessions -template")
 	fs.StringVar(&opts.validateg, "file", ".", "File or glob of files to validate")
+	fs.StringVar(&opts.varsf, "vars", "", "File of name=value variables available to every session")
 	fs.BoolVar(&opts.verbose, "verbose", false, "Display all targets, not just errored ones")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
-		validate(opts)
-		return nil
+		return validate(opts)
 	}}
 }
 
-func validate(opts *validateOpts) {
+func validate(opts *validateOpts) error {
+	vars, err := readVariables(opts.varsf)
+	if err != nil {
+		return err
+	}
+	if opts.dataf != "" {
+		rows, err := korra.ReadDataFile(opts.dataf)
+		if err != nil {
+			return err
+		}
+		vars = korra.NewVariables(vars)
+		for _, row := range rows {
+			for column, value := range row {
+				vars.Set(column, value)
+			}
+		}
+	}
 	for _, scriptFile := range korra.GlobInputs(opts.validateg) {
-		messages, failures := validateScript(scriptFile, opts.verbose)
+		messages, failures := validateScript(scriptFile, vars, opts.verbose)
 		status := "OK"
 		if failures > 0 {
 			status = fmt.Sprintf("FAIL %d", failures)
@@ -39,13 +58,15 @@ func validate(opts *validateOpts) {
 			fmt.Println("")
 		}
 	}
+	return nil
 }
 
-func validateScript(scriptFile string, verbose bool) ([]string, int) {
+func validateScript(scriptFile string, vars *korra.Variables, verbose bool) ([]string, int) {
 	script, err := korra.CheckScript(scriptFile)
 	if err != nil {
 		return []string{err.Error()}, 1
 	}
+	script.CheckReferences(vars)
 	var messages []string
 	errors := 0
 	for _, action := range script.Actions {
@@ -53,22 +74,28 @@ func validateScript(scriptFile string, verbose bool) ([]string, int) {
 			errors += 1
 		}
 		if verbose {
-			message := fmt.Sprintf("%d: ", action.Line)
+			message := fmt.Sprintf("%s: ", action.Position())
 			if action.Error != nil {
 				message += fmt.Sprintf("INVALID %s", action.Error)
 			} else {
 				target := action.Target
 				if target.Comment != "" {
 					message += fmt.Sprintf("INFO => %s", target.Comment)
-				} else if target.PauseTime > 0 {
-					message += fmt.Sprintf("PAUSE for %d ms", target.PauseTime)
+				} else if target.IsPause() {
+					message += fmt.Sprintf("PAUSE for %s ms", target.Pause)
+				} else if target.IsControl() {
+					message += target.Control.String()
+				} else if target.IsCookies() {
+					message += fmt.Sprintf("COOKIES %s", target.Cookies)
+				} else if target.IsAssignment() {
+					message += fmt.Sprintf("SET %s => %s", target.VarName, target.VarValue)
 				} else {
 					pollingMessage := "NO"
 					if target.Poller.Active {
 						pollingMessage = fmt.Sprintf("YES, %s", target.Poller)
 					}
-					message += fmt.Sprintf("%s %s [Headers: %d] [Body? %t] [Polling? %s]",
-						target.Method, target.URL, len(target.Header), target.BodyPath != "", pollingMessage)
+					message += fmt.Sprintf("%s %s [Headers: %d] [Body? %t] [Polling? %s] [Extracts: %d]",
+						target.Method, target.URL, len(target.Header), target.BodyPath != "", pollingMessage, len(target.Extractors))
 				}
 			}
 			messages = append(messages, message)